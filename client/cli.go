@@ -2,17 +2,19 @@ package client
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"strings"
+	"termchat/pkg/protocol"
 )
 
-// SendCLI sends a message from the CLI/pipe to the server.
-func SendCLI(host, port, email, password, to, msg string) error {
-	addr := net.JoinHostPort(host, port)
-	conn, err := net.Dial("tcp", addr)
+// SendCLI sends a message from the CLI/pipe to the server. Without a
+// password the session cached by an earlier login is resumed instead.
+func SendCLI(host, port string, tlsCfg *tls.Config, email, password, to, msg string) error {
+	conn, err := Connect(host, port, tlsCfg)
 	if err != nil {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
@@ -20,15 +22,14 @@ func SendCLI(host, port, email, password, to, msg string) error {
 
 	reader := bufio.NewReader(conn)
 
-	// Consume welcome message
-	_, _ = reader.ReadString('\n')
-	_, _ = reader.ReadString('\n')
+	// 0. Negotiate framing (skips the telnet welcome banner)
+	if _, err := Handshake(conn, reader); err != nil {
+		return err
+	}
 
 	// 1. Login
-	fmt.Fprintf(conn, "/login %s %s\n", email, password)
-	resp, err := reader.ReadString('\n')
-	if err != nil || !strings.HasPrefix(resp, "OK LOGIN") {
-		return fmt.Errorf("login failed: %s", resp)
+	if err := authenticate(conn, reader, host, port, email, password); err != nil {
+		return err
 	}
 
 	// 2. Determine target
@@ -61,23 +62,87 @@ func SendCLI(host, port, email, password, to, msg string) error {
 		// Personal message
 		target := strings.TrimPrefix(to, "@")
 		fmt.Fprintf(conn, "/send %s %s\n", target, msg)
+		if err := expectFrame(reader, "SEND"); err != nil {
+			return err
+		}
 	} else {
 		// Group message
 		fmt.Fprintf(conn, "/group %s\n", to)
-		resp, _ = reader.ReadString('\n') // OK GROUP ...
-		if !strings.HasPrefix(resp, "OK GROUP") {
-			return fmt.Errorf("failed to open group: %s", resp)
+		// Skip history until the room is live
+		if err := expectFrame(reader, "GROUP", "READY"); err != nil {
+			return fmt.Errorf("failed to open group: %w", err)
 		}
-		// Ready for history? skip or read?
-		for {
-			line, _ := reader.ReadString('\n')
-			if strings.HasPrefix(line, "OK GROUP READY") {
-				break
+		fmt.Fprintf(conn, "%s\n", msg)
+		// Each non-empty line is its own message and gets its own reply
+		for _, line := range strings.Split(msg, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if err := expectFrame(reader, "SENT"); err != nil {
+				return err
 			}
 		}
-		fmt.Fprintf(conn, "%s\n", msg)
 	}
 
 	fmt.Println("Message sent successfully.")
 	return nil
 }
+
+// authenticate logs in with the password and caches the session token, or
+// resumes the cached session when no password is given.
+func authenticate(conn net.Conn, reader *bufio.Reader, host, port, email, password string) error {
+	if password != "" {
+		fmt.Fprintf(conn, "/login %s %s\n", email, password)
+		resp, err := ReadFrame(reader)
+		if err != nil || resp.Verb != "OK" || resp.Word(0) != "LOGIN" {
+			return fmt.Errorf("login failed: %s", describeFrame(resp))
+		}
+		if err := saveSession(host, port, email, resp.Word(2)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not cache session: %v\n", err)
+		}
+		return nil
+	}
+
+	session, ok := loadSession(host, port)
+	if !ok || (email != "" && session.Email != email) {
+		return fmt.Errorf("no saved session for %s, log in once with --pass", net.JoinHostPort(host, port))
+	}
+	fmt.Fprintf(conn, "/resume %s\n", session.Token)
+	resp, err := ReadFrame(reader)
+	if err != nil || resp.Verb != "OK" || resp.Word(0) != "LOGIN" {
+		_ = clearSession(host, port)
+		return fmt.Errorf("session expired, log in again with --pass: %s", describeFrame(resp))
+	}
+	return nil
+}
+
+// expectFrame reads frames until "OK <words...>" arrives, failing on ERR.
+func expectFrame(reader *bufio.Reader, words ...string) error {
+	for {
+		f, err := ReadFrame(reader)
+		if err != nil {
+			return err
+		}
+		if f.Verb == "ERR" {
+			return fmt.Errorf("%s", describeFrame(f))
+		}
+		if f.Verb != "OK" || len(f.Words) < len(words) {
+			continue
+		}
+		match := true
+		for i, w := range words {
+			if f.Words[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return nil
+		}
+	}
+}
+
+// describeFrame renders a frame as a single human readable line.
+func describeFrame(f protocol.Frame) string {
+	return strings.TrimSpace(strings.Join(append(append([]string{f.Verb}, f.Words...), f.Fields...), " "))
+}
@@ -1,13 +1,16 @@
 package client
 
 import (
+	"crypto/tls"
+
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-// RunClient starts the Bubble Tea TUI and connects to the TermChat server.
-func RunClient(host, port string) error {
+// RunClient starts the Bubble Tea TUI and connects to the TermChat server,
+// over TLS when tlsCfg is not nil.
+func RunClient(host, port string, tlsCfg *tls.Config) error {
 	p := tea.NewProgram(
-		InitialModel(host, port),
+		InitialModel(host, port, tlsCfg),
 		tea.WithAltScreen(),       // use the alternate terminal screen
 		tea.WithMouseCellMotion(), // optional: mouse support for scrolling
 	)
@@ -0,0 +1,20 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// saveExport writes an /account export to the home directory (or the
+// working directory without one) and returns where it went.
+func saveExport(name string, data []byte) (string, error) {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		dir = "."
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
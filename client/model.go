@@ -1,9 +1,17 @@
 package client
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"termchat/pkg/protocol"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -24,34 +32,67 @@ const (
 	stateSearch  // showing search results
 )
 
-type serverLineMsg string
+type serverFrameMsg protocol.Frame
 type connectedMsg struct{ conn net.Conn }
 type errMsg struct{ err error }
+type typingExpiredMsg struct{}
+
+const (
+	typingDebounce = 3 * time.Second // min gap between our /typing signals
+	typingTTL      = 5 * time.Second // how long a TYPING frame stays visible
+)
 
 func (e errMsg) Error() string { return e.err.Error() }
 
 // ChatMessage holds a parsed chat message for display
 type ChatMessage struct {
+	id        string // database ID, empty for ephemeral or not yet acknowledged messages
 	sender    string
 	timestamp string
 	content   string
 	reactions string
+	edited    bool
+	deleted   bool     // tombstone: content was wiped by /delete
+	parentID  string   // message this one replies to, empty if none
+	readBy    []string // users that have seen the message
 	isSelf    bool
 	isSystem  bool
 	isHistory bool // came from HIST (dimmed display)
+	failed    bool // own message the server refused, it will never get an ID
+	highlight bool // target of a /goto jump
+}
+
+// FindHit is one /find result that /goto can jump to
+type FindHit struct {
+	chat string // "@partner" or group name
+	id   string
+}
+
+// RoomEntry is one conversation in the sidebar room list
+type RoomEntry struct {
+	name     string // "@partner" or group name
+	unread   int
+	lastAt   string
+	preview  string // "<sender>: <text>" of the last message
+	presence string // online, away or offline; empty for groups
+	lastSeen string
 }
 
 // Notification shown in the sidebar / banner
 type Notification struct {
 	from     string
-	chatType string // "chat" or "tempchat" or "msg"
+	chatType string // "chat" or "tempchat" or "msg" or "mention" or "announce"
+	group    string // group name for group_msg / mention
+	preview  string // message snippet for mention, text for announce
 }
 
 type Model struct {
 	host string
 	port string
+	dial func() (net.Conn, error) // opens the server connection
 	conn net.Conn
-	inCh chan string
+	inCh chan protocol.Frame
+	caps map[string]bool // capabilities agreed in the HELLO handshake
 
 	state       appState
 	currentUser string
@@ -59,6 +100,11 @@ type Model struct {
 	// Auth fields
 	authInputs  [3]textinput.Model // 0=email, 1=password, 2=username
 	activeInput int
+	isReset     bool      // entering a mailed reset code and a new password
+	loginEmail  string    // account of the pending /login or /resume, cached with its token
+	resumeToken string    // session to resume on connect instead of the cached one
+	saveTokens  bool      // cache session tokens on disk (off for SSH sessions)
+	bellOut     io.Writer // terminal that receives the notification bell
 	isRegister  bool
 
 	// Main command input
@@ -68,11 +114,25 @@ type Model struct {
 
 	// Data
 	messages      []ChatMessage
-	rooms         []string
+	rooms         []RoomEntry // most recently active first
 	searchResult  []string
 	notifications []Notification // incoming chat/msg notifications
 	chatPartner   string         // active chat or tempchat partner
+	partnerState  string         // partner presence: online, away or offline
+	partnerSeen   string         // partner's last seen timestamp
 	chatReady     bool           // true after OK CHAT READY received
+	threadRoot    string         // root message ID while viewing a /thread, else empty
+	findHits      []FindHit      // results of the last /find, numbered from 1
+	jump          *FindHit       // /goto target still being loaded, nil if none
+	topic         string         // topic of the open group
+	exportName    string         // file of the /account export being received
+	exportData    []byte         // decoded EXPORT chunks so far
+
+	// History paging (/more)
+	loadingMore  bool          // between OK MORE <id> and OK MORE END
+	olderBuf     []ChatMessage // older page being received
+	historyStart bool          // no older messages left on the server
+	scrollTo     int           // viewport offset to restore after a page was prepended, -1 if none
 
 	width    int
 	height   int
@@ -85,9 +145,13 @@ type Model struct {
 
 	// Set to true for one frame when a notification arrives → emits terminal bell
 	needsBell bool
+
+	// Typing indicators
+	typing     map[string]time.Time // who is typing → when the indicator expires
+	lastTyping time.Time            // when we last sent /typing
 }
 
-func InitialModel(host, port string) Model {
+func InitialModel(host, port string, tlsCfg *tls.Config) Model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 
@@ -112,47 +176,68 @@ func InitialModel(host, port string) Model {
 	return Model{
 		host:       host,
 		port:       port,
+		dial:       func() (net.Conn, error) { return Connect(host, port, tlsCfg) },
 		state:      stateConnecting,
 		spinner:    s,
 		authInputs: [3]textinput.Model{email, password, username},
 		msgInput:   cmdInput,
 		historyIdx: -1,
+		scrollTo:   -1,
+		saveTokens: true,
+		bellOut:    os.Stdout,
 	}
 }
 
+// NewSessionModel is InitialModel for a TUI hosted by the server itself,
+// e.g. over SSH: dial connects to the chat backend, token is the session
+// the user already authenticated for and out is the user's terminal.
+// Nothing is cached on disk.
+func NewSessionModel(dial func() (net.Conn, error), token string, out io.Writer) Model {
+	m := InitialModel("", "", nil)
+	m.dial = dial
+	m.resumeToken = token
+	m.saveTokens = false
+	m.bellOut = out
+	return m
+}
+
 func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		m.spinner.Tick,
-		connectCmd(m.host, m.port),
+		connectCmd(m.dial),
 		textinput.Blink,
 	)
 }
 
-func connectCmd(host, port string) tea.Cmd {
+func connectCmd(dial func() (net.Conn, error)) tea.Cmd {
 	return func() tea.Msg {
-		conn, err := Connect(host, port)
+		conn, err := dial()
 		if err != nil {
 			return errMsg{err}
 		}
+		if err := SendHello(conn); err != nil {
+			conn.Close()
+			return errMsg{err}
+		}
 		return connectedMsg{conn}
 	}
 }
 
 // bellCmd writes ASCII BEL to the terminal for notification sound.
-func bellCmd() tea.Cmd {
+func bellCmd(out io.Writer) tea.Cmd {
 	return func() tea.Msg {
-		fmt.Print("\a")
+		io.WriteString(out, "\a")
 		return nil
 	}
 }
 
-func waitForServerLine(ch chan string) tea.Cmd {
+func waitForServerFrame(ch chan protocol.Frame) tea.Cmd {
 	return func() tea.Msg {
-		line, ok := <-ch
+		f, ok := <-ch
 		if !ok {
 			return errMsg{fmt.Errorf("server closed connection")}
 		}
-		return serverLineMsg(line)
+		return serverFrameMsg(f)
 	}
 }
 
@@ -174,23 +259,50 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case connectedMsg:
 		m.conn = msg.conn
-		m.inCh = make(chan string, 128)
+		m.inCh = make(chan protocol.Frame, 128)
 		go ReadLoop(m.conn, m.inCh)
 		m.state = stateAuth
-		return m, tea.Batch(waitForServerLine(m.inCh), textinput.Blink)
+		token := m.resumeToken
+		if session, ok := loadSession(m.host, m.port); ok && m.saveTokens {
+			m.loginEmail, token = session.Email, session.Token
+		}
+		if token != "" {
+			m.banner = "Resuming session..."
+			m.bannerOK = false
+			go Write(m.conn, "/resume "+token)
+		}
+		return m, tea.Batch(waitForServerFrame(m.inCh), textinput.Blink)
 
-	case serverLineMsg:
+	case serverFrameMsg:
 		m.needsBell = false
-		m = m.handleServerLine(string(msg))
+		m = m.handleServerFrame(protocol.Frame(msg))
 		m.viewport.SetContent(m.renderMessages())
-		m.viewport.GotoBottom()
-		cmds := []tea.Cmd{waitForServerLine(m.inCh)}
+		switch {
+		case m.scrollTo >= 0:
+			// Older page prepended: keep the previously top line in view
+			m.viewport.SetYOffset(m.scrollTo)
+			m.scrollTo = -1
+		case !m.loadingMore:
+			m.viewport.GotoBottom()
+		}
+		cmds := []tea.Cmd{waitForServerFrame(m.inCh)}
+		if msg.Verb == "TYPING" {
+			cmds = append(cmds, tea.Tick(typingTTL, func(time.Time) tea.Msg { return typingExpiredMsg{} }))
+		}
 		if m.needsBell {
-			cmds = append(cmds, bellCmd())
+			cmds = append(cmds, bellCmd(m.bellOut))
 			m.needsBell = false
 		}
 		return m, tea.Batch(cmds...)
 
+	case typingExpiredMsg:
+		for name, until := range m.typing {
+			if time.Now().After(until) {
+				delete(m.typing, name)
+			}
+		}
+		return m, nil
+
 	case errMsg:
 		m.banner = "✗ " + msg.Error()
 		m.bannerOK = false
@@ -203,45 +315,95 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m Model) handleServerLine(raw string) Model {
-	line := strings.TrimSpace(raw)
-
-	if strings.HasPrefix(line, "> ") {
-		line = strings.TrimSpace(strings.TrimPrefix(line, "> "))
-	}
-	if line == "" || line == ">" {
-		return m
-	}
-
-	parts := strings.Fields(line)
-	if len(parts) == 0 {
-		return m
-	}
+func (m Model) handleServerFrame(f protocol.Frame) Model {
+	switch f.Verb {
 
-	switch parts[0] {
+	// ── HELLO — negotiated protocol version & capabilities ──────────────────
+	case "HELLO":
+		m.caps = make(map[string]bool)
+		for _, c := range f.Words[1:] {
+			m.caps[c] = true
+		}
 
 	// ── OK ───────────────────────────────────────────────────────────────────
 	case "OK":
-		if len(parts) < 2 {
-			return m
-		}
-		switch parts[1] {
+		switch f.Word(0) {
 
 		case "LOGIN":
-			if len(parts) >= 3 {
-				m.currentUser = parts[2]
+			if f.Word(1) != "" {
+				if token := f.Word(2); token != "" && m.saveTokens {
+					_ = saveSession(m.host, m.port, m.loginEmail, token)
+				}
+				m.currentUser = f.Word(1)
 				m.state = stateMenu
 				m.banner = "✓ Logged in as " + m.currentUser
 				m.bannerOK = true
-				m.rooms = []string{}
 				m.messages = []ChatMessage{}
 				m.notifications = []Notification{}
 				for i := range m.authInputs {
 					m.authInputs[i].Blur()
 				}
 				m.msgInput.Focus()
-				go Write(m.conn, "/room")
+				m.refreshRooms()
+			}
+
+		case "LOGOUT":
+			m = m.signedOut()
+			m.banner = "✓ Logged out"
+			m.bannerOK = true
+
+		case "ACCOUNT":
+			if f.Word(1) == "CONFIRM" {
+				m.banner = fmt.Sprintf("Type /account delete confirm %s within 2 minutes to delete your account for good", f.Word(2))
+				m.bannerOK = false
+				break
+			}
+			m = m.signedOut()
+			m.banner = "✓ Account deleted"
+			m.bannerOK = true
+
+		case "EXPORT":
+			if !m.saveTokens {
+				// Hosted TUI: the file would land on the server, not with the user
+				m.exportName, m.exportData = "", nil
+				m.banner = "✗ Export needs the installed client, it is not available over SSH or the web"
+				m.bannerOK = false
+				break
+			}
+			if f.Word(1) != "END" {
+				m.exportName, m.exportData = f.Word(1), nil
+				m.banner = "Exporting account data..."
+				m.bannerOK = false
+				break
+			}
+			path, err := saveExport(m.exportName, m.exportData)
+			m.exportName, m.exportData = "", nil
+			if err != nil {
+				m.banner = "✗ Export failed: " + err.Error()
+				m.bannerOK = false
+				break
 			}
+			m.banner = "✓ Account data saved to " + path
+			m.bannerOK = true
+
+		case "FORGOT":
+			m.banner = "✓ If the account exists, a reset code is on its way"
+			m.bannerOK = true
+
+		case "RESET":
+			m.isReset = false
+			m.authInputs[2].Placeholder = "username"
+			m.authInputs[2].Reset()
+			m.authInputs[1].Reset()
+			m.authInputs[m.activeInput].Blur()
+			m.activeInput = 1
+			m.authInputs[1].Focus()
+			m.banner = "✓ Password changed — sign in with the new one"
+			m.bannerOK = true
+
+		case "PASSWD":
+			m.banner = "✓ Password changed, other sessions were signed out"
+			m.bannerOK = true
 
 		case "REGISTER":
 			m.banner = "✓ Registered! You can now log in."
@@ -256,17 +418,78 @@ func (m Model) handleServerLine(raw string) Model {
 
 		case "SEND":
 			m.banner = "✓ Message sent"
+			if id := f.Word(1); id != "" {
+				m.banner += " (#" + id + ")"
+			}
 			m.bannerOK = true
 
+		case "SENT":
+			// Ack for our own optimistic echo: attach the stored ID to it
+			m.ackSent(f.Word(1))
+
+		case "REACT":
+			m.applyReaction(f.Word(1), f.Word(2))
+
+		case "EDIT":
+			m.applyEdit(f.Word(1), f.Field(0))
+			m.banner = "✓ Edited #" + f.Word(1)
+			m.bannerOK = true
+
+		case "DELETE":
+			m.applyDelete(f.Word(1))
+			m.banner = "✓ Deleted #" + f.Word(1)
+			m.bannerOK = true
+
+		case "MORE":
+			if f.Word(1) != "END" {
+				// "OK MORE <before_id>" — an older page follows
+				m.loadingMore = true
+				m.olderBuf = nil
+				return m
+			}
+			m.loadingMore = false
+			if len(m.olderBuf) == 0 {
+				m.historyStart = true
+				m.banner = "Start of conversation"
+				m.bannerOK = true
+				m.seekJump()
+				return m
+			}
+			before := strings.Count(m.renderMessages(), "\n")
+			m.messages = append(m.olderBuf, m.messages...)
+			m.olderBuf = nil
+			m.scrollTo = strings.Count(m.renderMessages(), "\n") - before
+			m.banner = ""
+			m.seekJump()
+
+		case "THREAD":
+			switch f.Word(1) {
+			case "":
+				return m
+			case "READY":
+				m.banner = fmt.Sprintf("✓ Thread #%s — /thread to go back", m.threadRoot)
+				m.bannerOK = true
+			default:
+				// "OK THREAD <root_id>" — HIST frames for the thread follow
+				m.threadRoot = f.Word(1)
+			}
+
+		case "EDITS":
+			if f.Word(2) == "0" {
+				m.messages = append(m.messages, ChatMessage{
+					isSystem: true,
+					content:  fmt.Sprintf("#%s has no earlier revisions", f.Word(1)),
+				})
+			}
+
 		case "EXIT":
 			m.banner = "Disconnected"
 			m.bannerOK = false
 
 		case "CHAT":
-			if len(parts) < 3 {
+			switch f.Word(1) {
+			case "":
 				return m
-			}
-			switch parts[2] {
 			case "READY":
 				m.chatReady = true
 				m.messages = append(m.messages, ChatMessage{
@@ -275,6 +498,7 @@ func (m Model) handleServerLine(raw string) Model {
 				})
 				m.banner = fmt.Sprintf("✓ Chat with %s — /exit to leave", m.chatPartner)
 				m.bannerOK = true
+				m.seekJump()
 			case "EXIT":
 				m.messages = append(m.messages, ChatMessage{
 					isSystem: true,
@@ -283,13 +507,20 @@ func (m Model) handleServerLine(raw string) Model {
 				m.state = stateMenu
 				m.chatPartner = ""
 				m.chatReady = false
+				m.threadRoot = ""
 				m.msgInput.Focus()
+				m.refreshRooms()
 			default:
 				// "OK CHAT <partner>" — entering chat mode
-				partner := parts[2]
+				partner := f.Word(1)
+				m.clearUnread("@" + partner)
+				m.typing = nil
 				m.chatPartner = partner
+				m.partnerState, m.partnerSeen = f.Field(0), f.Field(1)
+				m.resetPaging()
 				m.state = stateHistory
 				m.chatReady = false
+				m.threadRoot = ""
 				m.messages = []ChatMessage{}
 				m.msgInput.Focus()
 				m.banner = fmt.Sprintf("Loading history with %s...", partner)
@@ -299,11 +530,11 @@ func (m Model) handleServerLine(raw string) Model {
 			}
 
 		case "TEMPCHAT":
-			if len(parts) < 3 {
+			partner := f.Word(1)
+			switch partner {
+			case "":
 				return m
-			}
-			partner := parts[2]
-			if partner == "EXIT" {
+			case "EXIT":
 				m.messages = append(m.messages, ChatMessage{
 					isSystem: true,
 					content:  "Temp chat ended",
@@ -311,8 +542,10 @@ func (m Model) handleServerLine(raw string) Model {
 				m.state = stateMenu
 				m.chatPartner = ""
 				m.msgInput.Focus()
-			} else {
+			default:
+				m.typing = nil
 				m.chatPartner = partner
+				m.partnerState, m.partnerSeen = f.Field(0), f.Field(1)
 				m.state = stateChat
 				m.messages = []ChatMessage{}
 				m.banner = fmt.Sprintf("✓ Temp chatting with %s — /exit to leave", partner)
@@ -322,14 +555,9 @@ func (m Model) handleServerLine(raw string) Model {
 			}
 
 		case "GROUP":
-			if len(parts) < 3 {
+			switch f.Word(1) {
+			case "":
 				return m
-			}
-			// Use original line to extract name properly if it has spaces
-			// OK GROUP <name> <id>
-			fullLine := strings.Join(parts[2:], " ")
-
-			switch parts[2] {
 			case "READY":
 				m.chatReady = true
 				m.messages = append(m.messages, ChatMessage{
@@ -338,6 +566,7 @@ func (m Model) handleServerLine(raw string) Model {
 				})
 				m.banner = fmt.Sprintf("✓ Room %s — /exit to leave", m.chatPartner)
 				m.bannerOK = true
+				m.seekJump()
 			case "EXIT":
 				m.messages = append(m.messages, ChatMessage{
 					isSystem: true,
@@ -346,18 +575,20 @@ func (m Model) handleServerLine(raw string) Model {
 				m.state = stateMenu
 				m.chatPartner = ""
 				m.chatReady = false
+				m.threadRoot = ""
 				m.msgInput.Focus()
+				m.refreshRooms()
 			default:
-				// Extract name and id from fullLine
-				// We assume last field is ID
-				lastSpace := strings.LastIndex(fullLine, " ")
-				name := fullLine
-				if lastSpace != -1 {
-					name = fullLine[:lastSpace]
-				}
+				// OK GROUP <name> <id>
+				name := f.Word(1)
+				m.clearUnread(name)
+				m.topic = ""
+				m.typing = nil
 				m.chatPartner = name
+				m.resetPaging()
 				m.state = stateGroup
 				m.chatReady = false
+				m.threadRoot = ""
 				m.messages = []ChatMessage{}
 				m.msgInput.Focus()
 				m.banner = fmt.Sprintf("Loading room %s...", name)
@@ -365,113 +596,314 @@ func (m Model) handleServerLine(raw string) Model {
 				m.dismissNotification(name)
 			}
 
-		case "JOIN", "LEAVE", "CREATE", "KICK", "INVITE":
-			m.banner = "✓ " + strings.Join(parts[1:], " ")
+		case "SSHKEY":
+			m.banner = "✓ SSH key " + strings.ToLower(f.Word(1)) + " " + f.Word(2)
+			m.bannerOK = true
+
+		case "PIN", "UNPIN", "TOPIC":
+			// The room event that follows shows the change
+			m.banner = map[string]string{"PIN": "✓ Pinned", "UNPIN": "✓ Unpinned", "TOPIC": "✓ Topic updated"}[f.Word(0)]
+			m.bannerOK = true
+
+		case "INVITECODE":
+			// OK INVITECODE <group> <code> <uses> <expires_at>
+			uses := f.Word(3) + " use(s)"
+			if f.Word(3) == "-1" {
+				uses = "unlimited uses"
+			}
+			text := fmt.Sprintf("Invite code for %s: %s — %s, expires %s. Share it, they type /redeem %s",
+				f.Word(1), f.Word(2), uses, formatExpiry(f.Word(4)), f.Word(2))
+			m.messages = append(m.messages, ChatMessage{isSystem: true, content: text})
+			m.banner = "✓ Invite code " + f.Word(2)
+			m.bannerOK = true
+
+		case "REVOKECODE":
+			m.banner = "✓ Revoked invite code " + f.Word(1)
+			m.bannerOK = true
+
+		case "JOINREQ":
+			m.banner = fmt.Sprintf("✓ Asked to join %s, waiting for approval", f.Word(1))
+			m.bannerOK = true
+
+		case "JOIN", "LEAVE", "CREATE", "KICK", "INVITE", "PROMOTE", "DEMOTE", "TRANSFER", "APPROVE", "DENY", "VISIBILITY":
+			m.banner = "✓ " + strings.Join(f.Words, " ")
 			m.bannerOK = true
 			m.messages = append(m.messages, ChatMessage{
 				isSystem: true,
-				content:  "✓ " + strings.Join(parts[1:], " "),
+				content:  "✓ " + strings.Join(f.Words, " "),
 			})
 			// Auto refresh sidebar
-			go Write(m.conn, "/room")
+			m.refreshRooms()
 		}
 
 	// ── ERR ──────────────────────────────────────────────────────────────────
 	case "ERR":
-		m.banner = "✗ " + strings.Join(parts[1:], " ")
+		m.banner = "✗ " + strings.Join(append(append([]string{}, f.Words...), f.Fields...), " ")
 		m.bannerOK = false
+		// Errors that refuse a message or /reply leave its echo without an ID
+		switch {
+		case f.Word(0) == "MUTED", f.Word(0) == "RATE_LIMITED", f.Word(0) == "REPLY",
+			f.Word(1) == "send_failed" && (f.Word(0) == "CHAT" || f.Word(0) == "GROUP"):
+			m.failSent()
+		}
+		switch f.Word(1) {
+		case "too_many_attempts":
+			m.banner = fmt.Sprintf("✗ Too many attempts — try again in %ss", strings.TrimPrefix(f.Word(2), "retry_after="))
+		case "invalid_credentials":
+			m.banner = "✗ Invalid email or password"
+		case "export_unavailable":
+			m.banner = "✗ Export needs the installed client, it is not available over SSH or the web"
+		case "registration_failed":
+			m.banner = "✗ Registration failed — try another email or username"
+		case "banned":
+			until := "for good"
+			if t, err := time.Parse(time.RFC3339, strings.TrimPrefix(f.Word(2), "until=")); err == nil {
+				until = "until " + t.Local().Format("2006-01-02 15:04")
+			}
+			m.banner = "✗ Banned " + until
+			if f.Field(0) != "" {
+				m.banner += ": " + f.Field(0)
+			}
+		}
+		if f.Word(0) == "GROUP" {
+			switch f.Word(1) {
+			case "removed":
+				m.banner = fmt.Sprintf("✖ You were removed from %s", m.chatPartner)
+			case "not_a_member":
+				m.banner = "✗ You are not a member of that group — /join it first"
+			}
+		}
+		if f.Word(0) == "MUTED" {
+			m.banner = "✗ You are muted in this room"
+			if wait, ok := strings.CutPrefix(f.Word(1), "retry_after="); ok {
+				m.banner += fmt.Sprintf(" for another %ss", wait)
+			}
+		}
+		if f.Word(0) == "RATE_LIMITED" {
+			wait := strings.TrimPrefix(f.Word(1), "retry_after=")
+			if f.Field(0) == "muted" {
+				m.banner = fmt.Sprintf("✗ Muted for flooding — try again in %ss", wait)
+			} else {
+				m.banner = fmt.Sprintf("✗ Slow down — try again in %ss", wait)
+			}
+		}
+		if f.Word(0) == "RESUME" || f.Word(1) == "session_revoked" {
+			// Cached token expired or was revoked: fall back to the login form
+			if m.saveTokens {
+				_ = clearSession(m.host, m.port)
+			}
+			m.banner = "Session expired, please log in"
+		}
 
 	// ── ROOM ─────────────────────────────────────────────────────────────────
+	// Format: ROOM <name> <unread>|<last_at>|<last_sender>|<preview>[|<presence>|<last_seen>]
 	case "ROOM":
-		if len(parts) == 2 && parts[1] != "NONE" {
-			m.rooms = append(m.rooms, parts[1])
+		if name := f.Word(0); name != "" && name != "NONE" {
+			unread, _ := strconv.Atoi(f.Field(0))
+			room := RoomEntry{name: name, unread: unread, lastAt: f.Field(1), presence: f.Field(4), lastSeen: f.Field(5)}
+			if f.Field(2) != "" {
+				room.preview = f.Field(2) + ": " + f.Field(3)
+			}
+			m.rooms = append(m.rooms, room)
 		}
 
 	// ── HIST — chat history line ──────────────────────────────────────────────
-	// Format: HIST <timestamp>|<sender>|<content>|<reactions>
+	// Fields: <id>|<timestamp>|<sender>|<content>|<reactions>|<flags>|<parent_id>|<read_by>
 	case "HIST":
-		payload := strings.Join(parts[1:], " ")
-		segs := strings.SplitN(payload, "|", 4)
-		if len(segs) >= 3 {
-			ts, sender, content := segs[0], segs[1], segs[2]
-			reactions := ""
-			if len(segs) == 4 {
-				reactions = segs[3]
-			}
-			m.messages = append(m.messages, ChatMessage{
+		if len(f.Fields) >= 4 {
+			sender := f.Field(2)
+			flags := strings.Split(f.Field(5), ",")
+			msg := ChatMessage{
+				id:        f.Field(0),
 				sender:    sender,
-				timestamp: ts,
-				content:   content,
-				reactions: reactions,
+				timestamp: f.Field(1),
+				content:   f.Field(3),
+				reactions: f.Field(4),
+				edited:    hasFlag(flags, "edited"),
+				deleted:   hasFlag(flags, "deleted"),
+				parentID:  f.Field(6),
 				isSelf:    sender == m.currentUser,
 				isHistory: true,
-			})
+			}
+			if readBy := f.Field(7); readBy != "" {
+				msg.readBy = strings.Split(readBy, ",")
+			}
+			switch {
+			case m.loadingMore:
+				m.olderBuf = append(m.olderBuf, msg)
+			case m.threadRoot != "":
+				// /thread replays messages we may already hold
+				m.upsertMessage(msg)
+			default:
+				m.messages = append(m.messages, msg)
+			}
+		}
+
+	// ── EDIT — a message was edited by its sender ─────────────────────────────
+	// Fields: <id>|<sender>|<edited_at>|<content>
+	case "EDIT":
+		m.applyEdit(f.Field(0), f.Field(3))
+
+	// ── DELETE — a message was retracted ──────────────────────────────────────
+	// Fields: <id>|<deleted_by>
+	case "DELETE":
+		m.applyDelete(f.Field(0))
+
+	// ── TYPING — <user> is composing a message ──────────────────────────────────
+	case "TYPING":
+		if who := f.Word(0); who != "" && who != m.currentUser {
+			if m.typing == nil {
+				m.typing = make(map[string]time.Time)
+			}
+			m.typing[who] = time.Now().Add(typingTTL)
 		}
 
+	// ── READ — <user> has seen everything up to <id> ────────────────────────────
+	case "READ":
+		m.applyRead(f.Word(0), f.Word(1))
+
+	// ── EDITS — one prior revision, answer to /edits <id> ─────────────────────
+	// Fields: <id>|<edited_at>|<content>
+	case "EDITS":
+		m.messages = append(m.messages, ChatMessage{
+			isSystem: true,
+			content:  fmt.Sprintf("#%s before %s: %s", f.Field(0), shortTimestamp(f.Field(1)), f.Field(2)),
+		})
+
 	// ── SEARCH ───────────────────────────────────────────────────────────────
+	// Format: SEARCH <user> <email> <presence>|<last_seen>
 	case "SEARCH":
-		if len(parts) >= 2 && parts[1] != "NONE" {
-			m.searchResult = append(m.searchResult, strings.Join(parts[1:], " "))
+		if len(f.Words) >= 1 && f.Word(0) != "NONE" {
+			entry := strings.Join(f.Words, " ")
+			if state := presenceLabel(f.Field(0), f.Field(1)); state != "" {
+				entry += " · " + state
+			}
+			m.searchResult = append(m.searchResult, entry)
 		}
 
-	// ── MSG — live message ────────────────────────────────────────────────────
-	// Format: MSG <sessionID>|<sender>|<timestamp>|<content>
-	//    or:  MSG <sessionID>|<sender>|/close  (tempchat partner left)
-	case "MSG":
-		payload := strings.Join(parts[1:], " ")
-		segs := strings.SplitN(payload, "|", 4)
-		switch len(segs) {
-		case 4:
-			if segs[2] == "REACTION" {
-				m.messages = append(m.messages, ChatMessage{
-					isSystem: true,
-					content:  fmt.Sprintf(" %s reacted with %s to last message", segs[1], segs[3]),
-				})
-			} else if segs[3] == "/close" {
-				m.messages = append(m.messages, ChatMessage{
-					content:  segs[1] + " left the chat",
-					isSystem: true,
-				})
-				m.state = stateMenu
-				m.chatPartner = ""
-				m.chatReady = false
-				m.msgInput.Focus()
-			} else {
-				m.messages = append(m.messages, ChatMessage{
-					sender:    segs[1],
-					timestamp: segs[2],
-					content:   segs[3],
-					isSelf:    segs[1] == m.currentUser,
-				})
+	// ── TOPIC — group topic on open, or changed by <by> ─────────────────────
+	// Fields: <by>|<topic>
+	case "TOPIC":
+		m.topic = f.Field(1)
+		if by := f.Field(0); by != "" {
+			text := fmt.Sprintf("%s changed the topic: %s", by, m.topic)
+			if m.topic == "" {
+				text = by + " cleared the topic"
 			}
-		case 3:
-			if segs[2] == "/close" {
-				m.messages = append(m.messages, ChatMessage{
-					content:  segs[1] + " left the chat",
-					isSystem: true,
-				})
-				m.state = stateMenu
-				m.chatPartner = ""
-				m.chatReady = false
-				m.msgInput.Focus()
-			} else {
-				m.messages = append(m.messages, ChatMessage{
-					sender:    segs[0],
-					timestamp: segs[1],
-					content:   segs[2],
-					isSelf:    segs[0] == m.currentUser,
-				})
+			m.messages = append(m.messages, ChatMessage{isSystem: true, content: text})
+		}
+
+	// ── INVITECODE — outstanding invite code, answer to /invitecodes ───────
+	// Format: INVITECODE <code> <uses_left>|<expires_at>|<created_by>
+	case "INVITECODE":
+		text := "No invite codes"
+		if code := f.Word(0); code != "NONE" {
+			uses := f.Field(0) + " use(s) left"
+			if f.Field(0) == "-1" {
+				uses = "unlimited uses"
 			}
-		case 2:
+			text = fmt.Sprintf("%s — %s, expires %s, by %s", code, uses, formatExpiry(f.Field(1)), f.Field(2))
+		}
+		m.messages = append(m.messages, ChatMessage{isSystem: true, content: text})
+
+	// ── JOINREQ — pending request to join a private group, answer to /requests
+	case "JOINREQ":
+		text := "No pending join requests"
+		if f.Word(0) != "NONE" {
+			text = fmt.Sprintf("@%s asks to join %s", f.Word(1), f.Word(0))
+		}
+		m.messages = append(m.messages, ChatMessage{isSystem: true, content: text})
+
+	// ── NOTICE — something changed in the room, e.g. a new owner ──────────
+	case "NOTICE":
+		m.messages = append(m.messages, ChatMessage{isSystem: true, content: "ℹ " + f.Field(0)})
+
+	// ── PIN — pinned message of the group, id 0 when unpinned ──────────────
+	// Fields: <id>|<author>|<content>
+	case "PIN":
+		text := "📌 Nothing pinned anymore"
+		if id := f.Field(0); id != "" && id != "0" {
+			text = fmt.Sprintf("📌 Pinned #%s %s: %s", id, f.Field(1), f.Field(2))
+		}
+		m.messages = append(m.messages, ChatMessage{isSystem: true, content: text})
+
+	// ── EXPORT — one base64 chunk of an /account export ─────────────────────
+	case "EXPORT":
+		if m.exportName != "" {
+			if chunk, err := base64.StdEncoding.DecodeString(f.Word(0)); err == nil {
+				m.exportData = append(m.exportData, chunk...)
+			}
+		}
+
+	// ── FIND — message search hit ───────────────────────────────────────────
+	// Format: FIND <chat> <id>|<timestamp>|<sender>|<content>
+	case "FIND":
+		if chat := f.Word(0); chat != "" && chat != "NONE" {
+			m.findHits = append(m.findHits, FindHit{chat: chat, id: f.Field(0)})
+			m.messages = append(m.messages, ChatMessage{
+				isSystem: true,
+				content: fmt.Sprintf("[%d] %s #%s %s %s: %s", len(m.findHits), chat, f.Field(0),
+					shortTimestamp(f.Field(1)), f.Field(2), f.Field(3)),
+			})
+		} else if chat == "NONE" {
+			m.banner = "No messages found"
+			m.bannerOK = false
+		}
+
+	// ── SSHKEY — a registered SSH public key ───────────────────────────────
+	// Format: SSHKEY <fingerprint> <comment>
+	case "SSHKEY":
+		if f.Word(0) == "NONE" {
+			m.messages = append(m.messages, ChatMessage{isSystem: true, content: "No SSH keys registered"})
+		} else if f.Word(0) != "" {
+			m.messages = append(m.messages, ChatMessage{isSystem: true, content: "🔑 " + strings.Join(f.Words, " ")})
+		}
+
+	// ── WHO — connected users ────────────────────────────────────────────────
+	// Format: WHO <user> <online|away>
+	case "WHO":
+		if f.Word(0) != "" && f.Word(0) != "NONE" {
+			m.searchResult = append(m.searchResult, f.Word(0)+" · "+f.Word(1))
+		}
+
+	// ── MSG — live message ────────────────────────────────────────────────────
+	// Fields: <id>|<sender>|<timestamp>|<content>|<parent_id>  (id is empty in tempchat)
+	//    or:  <sender>|/close  (tempchat partner left)
+	case "MSG":
+		switch {
+		case len(f.Fields) == 2 && f.Field(1) == "/close":
+			m.messages = append(m.messages, ChatMessage{
+				content:  f.Field(0) + " left the chat",
+				isSystem: true,
+			})
+			m.state = stateMenu
+			m.chatPartner = ""
+			m.chatReady = false
+			m.msgInput.Focus()
+		case len(f.Fields) >= 4:
+			delete(m.typing, f.Field(1))
 			m.messages = append(m.messages, ChatMessage{
-				sender:  segs[0],
-				content: segs[1],
-				isSelf:  segs[0] == m.currentUser,
+				id:        f.Field(0),
+				sender:    f.Field(1),
+				timestamp: f.Field(2),
+				content:   f.Field(3),
+				parentID:  f.Field(4),
+				isSelf:    f.Field(1) == m.currentUser,
 			})
 		default:
 			m.messages = append(m.messages, ChatMessage{
-				content:  payload,
+				content:  strings.Join(f.Fields, " "),
+				isSystem: true,
+			})
+		}
+
+	// ── REACTION — live reaction ──────────────────────────────────────────────
+	// Fields: <id>|<sender>|<emoji>
+	case "REACTION":
+		if !m.applyReaction(f.Field(0), f.Field(2)) {
+			m.messages = append(m.messages, ChatMessage{
 				isSystem: true,
+				content:  fmt.Sprintf(" %s reacted with %s to #%s", f.Field(1), f.Field(2), f.Field(0)),
 			})
 		}
 
@@ -481,12 +913,14 @@ func (m Model) handleServerLine(raw string) Model {
 	//         NOTIFY MSG <sender>
 	//         NOTIFY INVITE <group>
 	//         NOTIFY KICK <group>
+	//         NOTIFY GROUP_MSG <sender>|<group>
+	//         NOTIFY MENTION <sender>|<group>|<preview>
 	case "NOTIFY":
-		if len(parts) < 3 {
+		notifType := f.Word(0) // CHAT, TEMPCHAT, MSG, INVITE, KICK, GROUP_MSG, MENTION, ANNOUNCE
+		from := f.Field(0)
+		if notifType == "" || from == "" {
 			return m
 		}
-		notifType := parts[1] // CHAT, TEMPCHAT, MSG, INVITE, KICK, GROUP_MSG
-		from := parts[2]
 
 		// Don't notify about your own actions
 		if from == m.currentUser {
@@ -495,13 +929,32 @@ func (m Model) handleServerLine(raw string) Model {
 
 		var notif Notification
 		if notifType == "GROUP_MSG" {
-			segs := strings.SplitN(from, "|", 2)
-			if len(segs) == 2 {
-				notif = Notification{from: segs[0], chatType: "group_msg"}
-				m.banner = fmt.Sprintf("🔔 %s messaged in #%s", segs[0], segs[1])
-			} else {
+			if len(f.Fields) < 2 {
+				return m
+			}
+			notif = Notification{from: from, chatType: "group_msg", group: f.Field(1)}
+			m.bumpUnread(f.Field(1))
+			m.banner = fmt.Sprintf("🔔 %s messaged in #%s", from, f.Field(1))
+		} else if notifType == "ANNOUNCE" {
+			notif = Notification{from: from, chatType: "announce", preview: f.Field(1)}
+			m.banner = fmt.Sprintf("📢 @%s: %s", from, f.Field(1))
+			m.messages = append(m.messages, ChatMessage{
+				isSystem: true,
+				content:  fmt.Sprintf("📢 Announcement from @%s: %s", from, f.Field(1)),
+			})
+		} else if notifType == "JOINREQ" {
+			if len(f.Fields) < 2 {
 				return m
 			}
+			notif = Notification{from: from, chatType: "joinreq", group: f.Field(1)}
+			m.banner = fmt.Sprintf("🔔 @%s asks to join %s — /approve %s %s", from, f.Field(1), f.Field(1), from)
+		} else if notifType == "MENTION" {
+			if len(f.Fields) < 2 {
+				return m
+			}
+			notif = Notification{from: from, chatType: "mention", group: f.Field(1), preview: f.Field(2)}
+			m.bumpUnread(f.Field(1))
+			m.banner = fmt.Sprintf("📣 @%s mentioned you in #%s", from, f.Field(1))
 		} else {
 			notif = Notification{from: from, chatType: strings.ToLower(notifType)}
 			switch notifType {
@@ -510,11 +963,19 @@ func (m Model) handleServerLine(raw string) Model {
 			case "TEMPCHAT":
 				m.banner = "🔔 @" + from + " /tempchat"
 			case "MSG":
+				m.bumpUnread("@" + from)
 				m.banner = "🔔 message from @" + from
 			case "INVITE":
 				m.banner = "★ invited to " + from
 			case "KICK":
 				m.banner = "✖ kicked from " + from
+			case "APPROVED":
+				m.banner = "★ you may now join " + from
+			case "DENIED":
+				m.banner = "✖ request to join " + from + " was declined"
+			case "ROLE":
+				notif.preview = f.Field(1)
+				m.banner = fmt.Sprintf("★ you are now %s in %s", f.Field(1), from)
 			}
 		}
 
@@ -522,8 +983,9 @@ func (m Model) handleServerLine(raw string) Model {
 
 		// Keep at most 5 notifications
 		// Avoid duplicate notifications from the same person for the same type
-		for _, n := range m.notifications {
-			if n.from == from && n.chatType == notif.chatType {
+		for i, n := range m.notifications {
+			if n.from == from && n.chatType == notif.chatType && n.group == notif.group {
+				m.notifications[i] = notif // keep the latest preview
 				m.needsBell = true
 				return m
 			}
@@ -539,25 +1001,381 @@ func (m Model) handleServerLine(raw string) Model {
 	return m
 }
 
-// dismissNotification removes any notification from the given user
+// ackSent attaches a server-assigned ID to the oldest own message still
+// waiting for one.
+func (m *Model) ackSent(id string) {
+	if id == "" {
+		return
+	}
+	for i := range m.messages {
+		if m.pendingSent(i) {
+			m.messages[i].id = id
+			return
+		}
+	}
+}
+
+// failSent marks the oldest own message still waiting for an ID as refused.
+// The server answers sends in order, so the error belongs to that one and
+// the next OK SENT must not be bound to it.
+func (m *Model) failSent() {
+	for i := range m.messages {
+		if m.pendingSent(i) {
+			m.messages[i].failed = true
+			return
+		}
+	}
+}
+
+// pendingSent reports whether message i is an optimistic echo still waiting
+// for OK SENT.
+func (m *Model) pendingSent(i int) bool {
+	msg := m.messages[i]
+	return msg.isSelf && !msg.isSystem && !msg.failed && msg.id == ""
+}
+
+// applyReaction adds an emoji to the message with the given ID. It returns
+// false when that message is not in the current view.
+func (m *Model) applyReaction(id, emoji string) bool {
+	if id == "" || emoji == "" {
+		return false
+	}
+	for i := range m.messages {
+		if m.messages[i].id == id {
+			m.messages[i].reactions = addReaction(m.messages[i].reactions, emoji)
+			return true
+		}
+	}
+	return false
+}
+
+// applyEdit replaces the content of the message with the given ID in place.
+func (m *Model) applyEdit(id, content string) {
+	if id == "" {
+		return
+	}
+	for i := range m.messages {
+		if m.messages[i].id == id {
+			m.messages[i].content = content
+			m.messages[i].edited = true
+			return
+		}
+	}
+}
+
+// applyDelete turns the message with the given ID into a tombstone.
+func (m *Model) applyDelete(id string) {
+	if id == "" {
+		return
+	}
+	for i := range m.messages {
+		if m.messages[i].id == id {
+			m.messages[i].content = ""
+			m.messages[i].reactions = ""
+			m.messages[i].deleted = true
+			return
+		}
+	}
+}
+
+// applyRead marks every message up to id as seen by reader, except the
+// reader's own messages.
+func (m *Model) applyRead(id, reader string) {
+	upTo, err := strconv.Atoi(id)
+	if err != nil || reader == "" {
+		return
+	}
+	for i := range m.messages {
+		msg := &m.messages[i]
+		n, err := strconv.Atoi(msg.id)
+		if err != nil || n > upTo || msg.sender == reader || msg.deleted {
+			continue
+		}
+		seen := false
+		for _, r := range msg.readBy {
+			if r == reader {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			msg.readBy = append(msg.readBy, reader)
+		}
+	}
+}
+
+// upsertMessage replaces the message with the same ID, or inserts it in ID
+// order when it is not loaded yet.
+func (m *Model) upsertMessage(msg ChatMessage) {
+	newID, _ := strconv.Atoi(msg.id)
+	for i := range m.messages {
+		if m.messages[i].id == msg.id {
+			m.messages[i] = msg
+			return
+		}
+		if id, err := strconv.Atoi(m.messages[i].id); err == nil && id > newID {
+			m.messages = append(m.messages[:i], append([]ChatMessage{msg}, m.messages[i:]...)...)
+			return
+		}
+	}
+	m.messages = append(m.messages, msg)
+}
+
+// inThread reports whether msg is the thread root or one of its replies.
+func inThread(msg ChatMessage, root string, byID map[string]*ChatMessage) bool {
+	for hops := 0; hops <= len(byID); hops++ {
+		if msg.id == root {
+			return true
+		}
+		parent, ok := byID[msg.parentID]
+		if !ok {
+			return false
+		}
+		msg = *parent
+	}
+	return false
+}
+
+// hasFlag reports whether a HIST flag list contains flag.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// addReaction bumps the count of emoji in a "{👍 2 ❤}" style summary.
+func addReaction(summary, emoji string) string {
+	type entry struct {
+		emoji string
+		count int
+	}
+	var entries []entry
+	for _, tok := range strings.Fields(strings.Trim(summary, "{}")) {
+		if n, err := strconv.Atoi(tok); err == nil && len(entries) > 0 {
+			entries[len(entries)-1].count = n
+			continue
+		}
+		entries = append(entries, entry{emoji: tok, count: 1})
+	}
+
+	found := false
+	for i := range entries {
+		if entries[i].emoji == emoji {
+			entries[i].count++
+			found = true
+		}
+	}
+	if !found {
+		entries = append(entries, entry{emoji: emoji, count: 1})
+	}
+
+	var res []string
+	for _, e := range entries {
+		if e.count > 1 {
+			res = append(res, fmt.Sprintf("%s %d", e.emoji, e.count))
+		} else {
+			res = append(res, e.emoji)
+		}
+	}
+	return "{" + strings.Join(res, " ") + "}"
+}
+
+// isChatCommand reports whether a line typed inside /chat or /group is a
+// command for the server rather than a message to echo.
+func isChatCommand(raw string) bool {
+	switch strings.Fields(raw)[0] {
+	case "/react", "/edit", "/edits", "/delete", "/thread", "/more", "/pin", "/unpin", "/topic":
+		return true
+	}
+	return false
+}
+
+// signalTyping sends a debounced /typing while the user writes a message.
+func (m *Model) signalTyping() {
+	raw := strings.TrimSpace(m.msgInput.Value())
+	if raw == "" || strings.HasPrefix(raw, "/") || time.Since(m.lastTyping) < typingDebounce {
+		return
+	}
+	m.lastTyping = time.Now()
+	go Write(m.conn, "/typing")
+}
+
+// typingUsers returns who is typing right now, sorted by name.
+func (m Model) typingUsers() []string {
+	var names []string
+	for name, until := range m.typing {
+		if time.Now().Before(until) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presenceLabel describes a user's presence, e.g. "online" or
+// "last seen 3h ago".
+func presenceLabel(state, lastSeen string) string {
+	switch state {
+	case "online", "away":
+		return state
+	}
+	if lastSeen == "" {
+		return state
+	}
+	return "last seen " + sinceLabel(lastSeen)
+}
+
+// sinceLabel turns a "2006-01-02 15:04:05" timestamp into "3h ago" style.
+func sinceLabel(ts string) string {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", ts, time.Local)
+	if err != nil {
+		return ts
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// resetPaging forgets the history paging state when a chat is (re)opened.
+func (m *Model) resetPaging() {
+	m.loadingMore = false
+	m.olderBuf = nil
+	m.historyStart = false
+	m.scrollTo = -1
+}
+
+// requestOlder asks for the page before the oldest loaded message, once the
+// user scrolls past the top.
+func (m *Model) requestOlder() {
+	if !m.chatReady || m.loadingMore || m.historyStart || m.threadRoot != "" {
+		return
+	}
+	for _, msg := range m.messages {
+		if _, err := strconv.Atoi(msg.id); err == nil {
+			m.loadingMore = true
+			m.banner = "⏳ Loading older messages..."
+			m.bannerOK = false
+			go Write(m.conn, "/more "+msg.id)
+			return
+		}
+	}
+	// Nothing stored in this chat yet
+	m.historyStart = true
+}
+
+// seekJump moves towards a pending /goto target once a chat has loaded:
+// older pages are requested until the message shows up, then it is
+// highlighted and scrolled into view.
+func (m *Model) seekJump() {
+	if m.jump == nil {
+		return
+	}
+	if m.jump.chat != m.chatPartner && m.jump.chat != "@"+m.chatPartner {
+		// A different chat was opened in the meantime
+		m.jump = nil
+		return
+	}
+	for i := range m.messages {
+		if m.messages[i].id == m.jump.id {
+			m.messages[i].highlight = true
+			before := *m
+			before.messages = m.messages[:i]
+			m.scrollTo = max(strings.Count(before.renderMessages(), "\n")-3, 0)
+			m.banner = fmt.Sprintf("✓ Jumped to #%s", m.jump.id)
+			m.bannerOK = true
+			m.jump = nil
+			return
+		}
+	}
+	if !m.historyStart {
+		m.requestOlder()
+	}
+	if m.historyStart {
+		m.banner = fmt.Sprintf("✗ #%s is no longer in this chat", m.jump.id)
+		m.bannerOK = false
+		m.jump = nil
+	}
+}
+
+// refreshRooms asks the server for a fresh room list.
+func (m *Model) refreshRooms() {
+	m.rooms = []RoomEntry{}
+	go Write(m.conn, "/room")
+}
+
+// bumpUnread counts one more unread message for a room we are not in and
+// moves it to the top of the list.
+func (m *Model) bumpUnread(name string) {
+	if name == m.chatPartner || "@"+m.chatPartner == name {
+		return
+	}
+	for i, r := range m.rooms {
+		if r.name == name {
+			r.unread++
+			m.rooms = append([]RoomEntry{r}, append(m.rooms[:i:i], m.rooms[i+1:]...)...)
+			return
+		}
+	}
+}
+
+// clearUnread resets the badge of a room once it is opened.
+func (m *Model) clearUnread(name string) {
+	for i := range m.rooms {
+		if m.rooms[i].name == name {
+			m.rooms[i].unread = 0
+		}
+	}
+}
+
+// dismissNotification removes any notification from the given user, or
+// about the given group
 func (m *Model) dismissNotification(from string) {
 	filtered := m.notifications[:0]
 	for _, n := range m.notifications {
-		if n.from != from {
+		if n.from != from && n.group != from {
 			filtered = append(filtered, n)
 		}
 	}
 	m.notifications = filtered
 }
 
-// renderMessages builds raw string content for the viewport
+// renderMessages builds raw string content for the viewport. Replies get a
+// quoted snippet of their parent, and a /thread view hides everything else.
 func (m Model) renderMessages() string {
 	if len(m.messages) == 0 {
 		return ""
 	}
+	byID := make(map[string]*ChatMessage, len(m.messages))
+	for i := range m.messages {
+		if m.messages[i].id != "" {
+			byID[m.messages[i].id] = &m.messages[i]
+		}
+	}
+
 	var sb strings.Builder
 	for _, msg := range m.messages {
-		sb.WriteString(formatChatMessage(msg, m.currentUser))
+		if m.threadRoot != "" && !msg.isSystem && !inThread(msg, m.threadRoot, byID) {
+			continue
+		}
+		if msg.parentID != "" && !msg.isSystem {
+			sb.WriteString(formatReplyQuote(msg.parentID, byID[msg.parentID]))
+			sb.WriteString("\n")
+		}
+		if msg.highlight {
+			sb.WriteString(styleOrange.Render("▶ "))
+		}
+		sb.WriteString(formatChatMessage(msg, m.currentUser, m.state == stateHistory))
 		sb.WriteString("\n")
 	}
 	return sb.String()
@@ -569,7 +1387,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 	// ── AUTH / REGISTER ──────────────────────────────────────────────────────
 	case stateAuth, stateRegister:
 		numFields := 2
-		if m.isRegister {
+		if m.isRegister || m.isReset {
 			numFields = 3
 		}
 
@@ -589,7 +1407,36 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 			m.authInputs[m.activeInput].Focus()
 			return m, textinput.Blink
 
+		case tea.KeyF2:
+			if m.isRegister || m.isReset {
+				return m, nil
+			}
+			email := strings.TrimSpace(m.authInputs[0].Value())
+			if email == "" {
+				m.banner = "✗ Enter your email first"
+				m.bannerOK = false
+				return m, nil
+			}
+			go Write(m.conn, "/forgot "+email)
+			m.isReset = true
+			m.authInputs[m.activeInput].Blur()
+			m.authInputs[1].Reset()
+			m.authInputs[2].Reset()
+			m.authInputs[2].Placeholder = "code from the email"
+			m.activeInput = 2
+			m.authInputs[2].Focus()
+			return m, textinput.Blink
+
 		case tea.KeyF1:
+			if m.isReset {
+				m.isReset = false
+				m.authInputs[2].Placeholder = "username"
+				m.authInputs[m.activeInput].Blur()
+				m.activeInput = 0
+				m.authInputs[0].Focus()
+				m.banner = ""
+				return m, textinput.Blink
+			}
 			m.isRegister = !m.isRegister
 			if m.isRegister {
 				m.state = stateRegister
@@ -605,6 +1452,19 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 			return m, textinput.Blink
 
 		case tea.KeyEnter:
+			if m.isReset {
+				code := strings.TrimSpace(m.authInputs[2].Value())
+				pass := strings.TrimSpace(m.authInputs[1].Value())
+				if code != "" && pass != "" {
+					go Write(m.conn, fmt.Sprintf("/reset %s %s", code, pass))
+					m.banner = "Resetting password..."
+					m.bannerOK = false
+				} else {
+					m.banner = "✗ Reset code and new password required"
+					m.bannerOK = false
+				}
+				return m, nil
+			}
 			if m.isRegister {
 				email := strings.TrimSpace(m.authInputs[0].Value())
 				username := strings.TrimSpace(m.authInputs[2].Value())
@@ -621,6 +1481,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 				email := strings.TrimSpace(m.authInputs[0].Value())
 				pass := strings.TrimSpace(m.authInputs[1].Value())
 				if email != "" && pass != "" {
+					m.loginEmail = email
 					go Write(m.conn, fmt.Sprintf("/login %s %s", email, pass))
 					m.banner = "Authenticating..."
 					m.bannerOK = false
@@ -682,8 +1543,30 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 				m.state = stateSearch
 				go Write(m.conn, raw)
 			case "/room":
-				m.rooms = []string{}
+				m.refreshRooms()
+			case "/who":
+				m.state = stateSearch
 				go Write(m.conn, raw)
+			case "/find":
+				m.findHits = nil
+				go Write(m.conn, raw)
+			case "/goto":
+				n := 0
+				if len(fields) == 2 {
+					n, _ = strconv.Atoi(fields[1])
+				}
+				if n < 1 || n > len(m.findHits) {
+					m.banner = "✗ Usage: /goto <result number from /find>"
+					m.bannerOK = false
+					break
+				}
+				hit := m.findHits[n-1]
+				m.jump = &hit
+				if strings.HasPrefix(hit.chat, "@") {
+					go Write(m.conn, "/chat "+strings.TrimPrefix(hit.chat, "@"))
+				} else {
+					go Write(m.conn, "/group "+hit.chat)
+				}
 			case "/tempchat":
 				go Write(m.conn, raw)
 			case "/chat":
@@ -735,6 +1618,9 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 	case stateHistory, stateGroup:
 		switch msg.Type {
 		case tea.KeyCtrlK:
+			if m.viewport.AtTop() {
+				m.requestOlder()
+			}
 			m.viewport.LineUp(1)
 			return m, nil
 		case tea.KeyCtrlJ:
@@ -791,6 +1677,40 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 				return m, nil
 			}
 
+			if raw == "/thread" {
+				// Leave the thread view, the full history is still loaded
+				m.threadRoot = ""
+				m.banner = ""
+				m.viewport.SetContent(m.renderMessages())
+				m.viewport.GotoBottom()
+				return m, nil
+			}
+
+			if parts := strings.SplitN(raw, " ", 3); parts[0] == "/reply" && len(parts) < 3 {
+				m.banner = "✗ Usage: /reply <id> <message>"
+				m.bannerOK = false
+				return m, nil
+			}
+
+			if parts := strings.SplitN(raw, " ", 3); parts[0] == "/reply" && len(parts) == 3 {
+				// Optimistic echo of the reply, acked with OK SENT like a message
+				m.messages = append(m.messages, ChatMessage{
+					sender:   m.currentUser,
+					content:  parts[2],
+					parentID: parts[1],
+					isSelf:   true,
+				})
+				go Write(m.conn, raw)
+				m.viewport.SetContent(m.renderMessages())
+				m.viewport.GotoBottom()
+				return m, nil
+			}
+
+			if isChatCommand(raw) {
+				go Write(m.conn, raw)
+				return m, nil
+			}
+
 			// Optimistic echo — server will NOT echo this back
 			m.messages = append(m.messages, ChatMessage{
 				sender:  m.currentUser,
@@ -805,6 +1725,9 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 		default:
 			var cmd tea.Cmd
 			m.msgInput, cmd = m.msgInput.Update(msg)
+			if m.chatReady {
+				m.signalTyping()
+			}
 			return m, cmd
 		}
 
@@ -878,6 +1801,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 		default:
 			var cmd tea.Cmd
 			m.msgInput, cmd = m.msgInput.Update(msg)
+			m.signalTyping()
 			return m, cmd
 		}
 	}
@@ -885,6 +1809,24 @@ func (m Model) handleKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 	return m, nil
 }
 
+// signedOut returns to the sign-in screen and forgets the cached session
+func (m Model) signedOut() Model {
+	if m.saveTokens {
+		_ = clearSession(m.host, m.port)
+	}
+	m.resumeToken = ""
+	m.currentUser = ""
+	m.state = stateAuth
+	m.rooms = nil
+	m.messages = []ChatMessage{}
+	m.notifications = []Notification{}
+	m.msgInput.Blur()
+	m.authInputs[1].Reset()
+	m.activeInput = 0
+	m.authInputs[0].Focus()
+	return m
+}
+
 func (m Model) View() string {
 	return Render(m)
 }
@@ -893,6 +1835,16 @@ func helpText() string {
 	return `Available commands:
   /register <email> <user> <pass>
   /login <email> <pass>
+  /logout                  — sign out and forget the saved session
+  /passwd <old> <new>      — change password (signs out other sessions)
+  /account export          — save your profile, messages and reactions as JSON
+  /account delete <mode>   — delete your account; mode anonymize keeps your
+                             messages under "deleted-<id>", purge removes them
+  /sshkey add <pubkey>     — allow an SSH key to log in (also list, remove <fp>)
+  /ban <user> [dur] [why]  — ban a user, e.g. /ban bob 7d spam (admin; /unban)
+  /mute <user> <room> [d]  — mute in a group or global (admin; /unmute)
+  /announce <text>         — message every online user (admin)
+  /purge <user>            — delete all of a user's messages (admin)
   /room                    — list chats/groups
   /chat <user>             — open private chat
   /group <name>            — open group chat
@@ -900,11 +1852,31 @@ func helpText() string {
   /tempchat <user>         — ephemeral chat
   /send <user> <msg>       — direct message
   /search <prefix>         — search users
+  /who                     — who is online
+  /find <words> [in chat]  — search your messages (chat: @user or group)
+  /goto <n>                — open result n of /find at that message
   /create <name> [desc]    — create a group
   /join <name>             — join a group
   /leave <name>            — leave a group
-  /kick <group> <user>     — kick from group (owner)
-  /invite <group> <user>   — invite to group (owner)
+  /invitecode <g> [n] [t]  — code to join g, n uses (0: any) within time t
+  /invitecodes <group>     — list codes (also /revokecode <group> <code>)
+  /redeem <code>           — join a group with an invite code
+  /visibility <g> <v>      — public, private or invite_only (owner, admin)
+  /requests <group>        — pending join requests (owner, admin)
+  /approve <g> <u>         — let a user into a private group (also /deny)
+  /kick <group> <user>     — kick from group (owner, admin, moderator)
+  /invite <group> <user>   — invite to group (owner, admin, moderator)
+  /promote <g> <u> <role>  — make admin or moderator (owner, admin)
+  /demote <g> <u> [role]   — lower a role, member by default
+  /transfer <group> <user> — make someone else the owner (owner)
+  /react [id] <emoji>      — react to a message (in chat)
+  /edit <id> <text>        — edit your message (in chat)
+  /edits <id>              — show earlier revisions (in chat)
+  /delete <id>             — delete a message: yours, or any as moderator+
+  /pin <id>, /unpin        — pin a message for the group (in group)
+  /topic <text>            — set the group topic (in group)
+  /reply <id> <text>       — reply to a message (in chat)
+  /thread [id]             — show only a thread / back (in chat)
   /theme <path>            — load a .json theme
   /clear                   — clear view
   /exit                    — exit chat/disconnect
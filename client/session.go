@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// savedSession is a cached login for one server
+type savedSession struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+// sessionFile is where session tokens are cached, one per server address.
+func sessionFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "termchat", "sessions.json"), nil
+}
+
+func loadSessions() map[string]savedSession {
+	sessions := make(map[string]savedSession)
+	path, err := sessionFile()
+	if err != nil {
+		return sessions
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sessions
+	}
+	_ = json.Unmarshal(data, &sessions)
+	return sessions
+}
+
+func writeSessions(sessions map[string]savedSession) error {
+	path, err := sessionFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The token is as good as the password, keep it private
+	return os.WriteFile(path, data, 0o600)
+}
+
+// loadSession returns the cached session for host:port, if any.
+func loadSession(host, port string) (savedSession, bool) {
+	s, ok := loadSessions()[net.JoinHostPort(host, port)]
+	return s, ok && s.Token != ""
+}
+
+// saveSession caches the token from OK LOGIN for host:port.
+func saveSession(host, port, email, token string) error {
+	if token == "" {
+		return errors.New("empty session token")
+	}
+	sessions := loadSessions()
+	sessions[net.JoinHostPort(host, port)] = savedSession{Email: email, Token: token}
+	return writeSessions(sessions)
+}
+
+// clearSession forgets the cached session for host:port.
+func clearSession(host, port string) error {
+	sessions := loadSessions()
+	if _, ok := sessions[net.JoinHostPort(host, port)]; !ok {
+		return nil
+	}
+	delete(sessions, net.JoinHostPort(host, port))
+	return writeSessions(sessions)
+}
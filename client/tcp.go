@@ -2,22 +2,115 @@ package client
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net"
+	"os"
+	"strings"
+	"termchat/pkg/protocol"
 )
 
-// Connect opens a TCP connection to the TermChat server.
-func Connect(host, port string) (net.Conn, error) {
-	return net.Dial("tcp", host+":"+port)
+// clientCaps are the optional protocol features this client understands.
+var clientCaps = []string{protocol.CapReactions, protocol.CapReceipts, protocol.CapTyping}
+
+// Connect opens a connection to the TermChat server, over TLS when tlsCfg
+// is not nil.
+func Connect(host, port string, tlsCfg *tls.Config) (net.Conn, error) {
+	addr := net.JoinHostPort(host, port)
+	if tlsCfg != nil {
+		return tls.Dial("tcp", addr, tlsCfg)
+	}
+	return net.Dial("tcp", addr)
+}
+
+// TLSConfig builds the client TLS config. caFile pins the server to that CA
+// instead of the system roots; certFile/keyFile add a client certificate
+// for servers that require one.
+func TLSConfig(host, caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
 }
 
-// ReadLoop reads newline-delimited lines from the server and sends each one
+// SendHello asks the server to switch this connection to the latest framing.
+func SendHello(conn net.Conn) error {
+	return Write(conn, protocol.Hello(protocol.Latest, clientCaps...))
+}
+
+// decodeLine turns one raw server line into a frame. Legacy text such as
+// the telnet welcome banner or the "> " prompt is reported as ok=false.
+func decodeLine(line string) (protocol.Frame, bool) {
+	line = strings.TrimSpace(line)
+	for strings.HasPrefix(line, ">") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, ">"))
+	}
+	if !protocol.IsFrame(line) {
+		return protocol.Frame{}, false
+	}
+	f, err := protocol.Decode(line)
+	if err != nil {
+		return protocol.Frame{}, false
+	}
+	return f, true
+}
+
+// ReadLoop reads newline-delimited frames from the server and sends each one
 // to inCh. It closes inCh when the connection is closed or an error occurs.
-func ReadLoop(conn net.Conn, inCh chan<- string) {
+func ReadLoop(conn net.Conn, inCh chan<- protocol.Frame) {
 	defer close(inCh)
 	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 	for scanner.Scan() {
-		inCh <- scanner.Text()
+		if f, ok := decodeLine(scanner.Text()); ok {
+			inCh <- f
+		}
+	}
+}
+
+// ReadFrame reads the next frame from reader, skipping legacy text lines.
+func ReadFrame(reader *bufio.Reader) (protocol.Frame, error) {
+	for {
+		line, err := reader.ReadString('\n')
+		if f, ok := decodeLine(line); ok {
+			return f, nil
+		}
+		if err != nil {
+			return protocol.Frame{}, err
+		}
+	}
+}
+
+// Handshake sends HELLO and waits for the server's reply.
+func Handshake(conn net.Conn, reader *bufio.Reader) (protocol.Frame, error) {
+	if err := SendHello(conn); err != nil {
+		return protocol.Frame{}, err
+	}
+	f, err := ReadFrame(reader)
+	if err != nil {
+		return protocol.Frame{}, fmt.Errorf("handshake failed: %w", err)
+	}
+	if f.Verb != "HELLO" {
+		return protocol.Frame{}, fmt.Errorf("handshake failed: unexpected %s", f.Verb)
 	}
+	return f, nil
 }
 
 // Write sends a single line (with trailing newline) to the server.
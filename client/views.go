@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -110,8 +111,11 @@ func renderConnecting(m Model) string {
 // ─── Auth ─────────────────────────────────────────────────────────────────────
 func renderAuth(m Model) string {
 	title := "Sign In"
-	if m.isRegister {
+	switch {
+	case m.isRegister:
 		title = "Create Account"
+	case m.isReset:
+		title = "Reset Password"
 	}
 
 	var fields strings.Builder
@@ -123,9 +127,23 @@ func renderAuth(m Model) string {
 	fields.WriteString(emailLabel + "\n")
 	fields.WriteString(m.authInputs[0].View() + "\n\n")
 
-	passLabel := styleMuted.Render("Password")
+	if m.isReset {
+		// The third input holds the mailed code while resetting
+		codeLabel := styleMuted.Render("Reset code")
+		if m.activeInput == 2 {
+			codeLabel = styleAccent.Render("Reset code")
+		}
+		fields.WriteString(codeLabel + "\n")
+		fields.WriteString(m.authInputs[2].View() + "\n\n")
+	}
+
+	passText := "Password"
+	if m.isReset {
+		passText = "New password"
+	}
+	passLabel := styleMuted.Render(passText)
 	if m.activeInput == 1 {
-		passLabel = styleAccent.Render("Password")
+		passLabel = styleAccent.Render(passText)
 	}
 	fields.WriteString(passLabel + "\n")
 	fields.WriteString(m.authInputs[1].View() + "\n\n")
@@ -142,11 +160,13 @@ func renderAuth(m Model) string {
 	fields.WriteString(renderBanner(m) + "\n\n")
 
 	submitLabel := "  [Enter] Sign In  "
-	if m.isRegister {
+	toggle := "  [F1] Create account  [F2] Forgot password  "
+	switch {
+	case m.isRegister:
 		submitLabel = "  [Enter] Register  "
-	}
-	toggle := "  [F1] Create account  "
-	if m.isRegister {
+		toggle = "  [F1] Sign in instead  "
+	case m.isReset:
+		submitLabel = "  [Enter] Set password  "
 		toggle = "  [F1] Sign in instead  "
 	}
 
@@ -234,10 +254,31 @@ func renderSidebar(m Model, w int) string {
 	sb.WriteString(stylePurple.Render("@"+m.currentUser) + "\n")
 	sb.WriteString(styleMuted.Render("● connected") + "\n\n")
 
+	// ── Mentions ───────────────────────────────────────────────
+	// Shown apart from ordinary notices so they are not lost in busy rooms
+	var mentions, others []Notification
+	for _, n := range m.notifications {
+		if n.chatType == "mention" {
+			mentions = append(mentions, n)
+		} else {
+			others = append(others, n)
+		}
+	}
+	if len(mentions) > 0 {
+		sb.WriteString(styleNotif.Render("📣 MENTIONS") + "\n")
+		for _, n := range mentions {
+			sb.WriteString(styleOrange.Render("@") + styleNotif.Render(fmt.Sprintf(" %s in #%s", n.from, n.group)) + "\n")
+			if n.preview != "" {
+				sb.WriteString(styleNotifDim.Render("  "+truncate(n.preview, w-8)) + "\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
 	// ── Notifications ──────────────────────────────────────────
-	if len(m.notifications) > 0 {
+	if len(others) > 0 {
 		sb.WriteString(styleNotif.Render("🔔 INCOMING") + "\n")
-		for _, n := range m.notifications {
+		for _, n := range others {
 			var icon, label string
 			switch n.chatType {
 			case "chat":
@@ -258,6 +299,21 @@ func renderSidebar(m Model, w int) string {
 			case "kick":
 				icon = styleDanger.Render("✖")
 				label = styleNotifDim.Render(fmt.Sprintf(" kicked from %s", n.from))
+			case "joinreq":
+				icon = styleOrange.Render("?")
+				label = styleNotifDim.Render(fmt.Sprintf(" @%s wants into %s", n.from, n.group))
+			case "approved":
+				icon = styleOK.Render("★")
+				label = styleNotifDim.Render(" let into " + n.from)
+			case "denied":
+				icon = styleDanger.Render("✖")
+				label = styleNotifDim.Render(" not let into " + n.from)
+			case "role":
+				icon = styleOK.Render("★")
+				label = styleNotifDim.Render(fmt.Sprintf(" %s in %s", n.preview, n.from))
+			case "announce":
+				icon = styleNotif.Render("📢")
+				label = styleNotifDim.Render(" @" + n.from + ": " + truncate(n.preview, w-8-len(n.from)))
 			default:
 				icon = styleMuted.Render("◆")
 				label = styleNotifDim.Render(" @" + n.from)
@@ -273,8 +329,15 @@ func renderSidebar(m Model, w int) string {
 		sb.WriteString(styleMuted.Render("  none yet") + "\n")
 	} else {
 		for _, r := range m.rooms {
-			dot := lipgloss.NewStyle().Foreground(colorRoomDot).Render("●")
-			sb.WriteString(fmt.Sprintf(" %s %s\n", dot, styleWhite.Render(r)))
+			dot := lipgloss.NewStyle().Foreground(presenceColor(r.presence)).Render("●")
+			sb.WriteString(fmt.Sprintf(" %s %s%s\n", dot, styleWhite.Render(r.name), formatUnreadBadge(r.unread)))
+			if r.preview != "" {
+				line := r.preview
+				if r.lastAt != "" {
+					line = shortTimestamp(r.lastAt) + " " + line
+				}
+				sb.WriteString(styleMuted.Render("   "+truncate(line, w-6)) + "\n")
+			}
 		}
 	}
 	sb.WriteString("\n")
@@ -444,6 +507,18 @@ func renderChatTopBar(m Model, chatType string, withHistory bool) string {
 	left := styleAccent.Render("⬡ TermChat  ›  ") +
 		stylePurple.Render(titlePrefix+m.chatPartner) +
 		"  " + badge
+	if chatType == "group" && m.topic != "" {
+		left += "  " + styleMuted.Render(truncate(m.topic, m.width/3))
+	}
+	if chatType != "group" {
+		if label := presenceLabel(m.partnerState, m.partnerSeen); label != "" {
+			left += "  " + lipgloss.NewStyle().Foreground(presenceColor(m.partnerState)).Render(label)
+		}
+	}
+
+	if typing := formatTyping(m.typingUsers()); typing != "" {
+		status = styleOrange.Render(typing)
+	}
 
 	right := styleMuted.Render(time.Now().Format("15:04")) + "  " + status
 
@@ -459,12 +534,55 @@ func renderChatTopBar(m Model, chatType string, withHistory bool) string {
 		Render(left + strings.Repeat(" ", gap) + right)
 }
 
+// presenceColor picks the room list dot color: green online, orange away,
+// grey offline. Groups (no presence) keep the room color.
+func presenceColor(state string) lipgloss.Color {
+	switch state {
+	case "online":
+		return colorAccent2
+	case "away":
+		return colorOrange
+	case "offline":
+		return colorHistory
+	}
+	return colorRoomDot
+}
+
+// formatTyping renders "alice is typing…" for the chat top bar.
+func formatTyping(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0] + " is typing…"
+	case 2:
+		return names[0] + " and " + names[1] + " are typing…"
+	default:
+		return "several people are typing…"
+	}
+}
+
 // ─── Message Formatting ───────────────────────────────────────────────────────
-func formatChatMessage(msg ChatMessage, currentUser string) string {
+// formatChatMessage renders one message line. dm selects ✓/✓✓ receipts for
+// personal chats instead of the "seen by" list used in groups.
+func formatChatMessage(msg ChatMessage, currentUser string, dm bool) string {
 	if msg.isSystem {
 		return styleSystemMsg.Render("  · " + msg.content)
 	}
 
+	if msg.deleted {
+		ts := ""
+		if msg.timestamp != "" {
+			ts = styleHistTs.Render(" " + shortTimestamp(msg.timestamp))
+		}
+		return fmt.Sprintf("%s%s%s  %s",
+			formatMessageID(msg.id, styleHistTs),
+			styleHistOther.Render(msg.sender),
+			ts,
+			styleSystemMsg.Render("message deleted"),
+		)
+	}
+
 	if msg.isHistory {
 		var nameStyle lipgloss.Style
 		if msg.isSelf || msg.sender == currentUser {
@@ -480,11 +598,14 @@ func formatChatMessage(msg ChatMessage, currentUser string) string {
 		if msg.reactions != "" {
 			reactions = " " + styleOrange.Render(msg.reactions)
 		}
-		return fmt.Sprintf("%s%s  %s%s",
+		return fmt.Sprintf("%s%s%s  %s%s%s%s",
+			formatMessageID(msg.id, styleHistTs),
 			nameStyle.Render(msg.sender),
 			ts,
 			styleMuted.Render(msg.content),
+			formatEdited(msg.edited),
 			reactions,
+			formatReceipt(msg, currentUser, dm),
 		)
 	}
 
@@ -500,13 +621,104 @@ func formatChatMessage(msg ChatMessage, currentUser string) string {
 		ts = styleTimestamp.Render(" " + shortTimestamp(msg.timestamp))
 	}
 
-	return fmt.Sprintf("%s%s  %s",
+	reactions := ""
+	if msg.reactions != "" {
+		reactions = " " + styleOrange.Render(msg.reactions)
+	}
+
+	return fmt.Sprintf("%s%s%s  %s%s%s%s",
+		formatMessageID(msg.id, styleTimestamp),
 		nameStyle.Render(msg.sender),
 		ts,
 		styleWhite.Render(msg.content),
+		formatEdited(msg.edited),
+		reactions,
+		formatReceipt(msg, currentUser, dm),
 	)
 }
 
+// formatReceipt renders read state for our own messages: ✓ once stored,
+// ✓✓ once the partner has read it, or "seen by ..." in groups. Messages the
+// server refused are flagged instead.
+func formatReceipt(msg ChatMessage, currentUser string, dm bool) string {
+	if msg.failed {
+		return styleDanger.Render(" ✗ not sent")
+	}
+	if msg.id == "" || !(msg.isSelf || msg.sender == currentUser) {
+		return ""
+	}
+	if dm {
+		if len(msg.readBy) > 0 {
+			return styleOK.Render(" ✓✓")
+		}
+		return styleMuted.Render(" ✓")
+	}
+	if len(msg.readBy) == 0 {
+		return ""
+	}
+	seen := strings.Join(msg.readBy, ", ")
+	if len(msg.readBy) > 3 {
+		seen = fmt.Sprintf("%s +%d", strings.Join(msg.readBy[:3], ", "), len(msg.readBy)-3)
+	}
+	return styleMuted.Render(" · seen by " + seen)
+}
+
+// formatUnreadBadge renders the unread count shown next to a room name.
+func formatUnreadBadge(unread int) string {
+	if unread == 0 {
+		return ""
+	}
+	label := strconv.Itoa(unread)
+	if unread > 99 {
+		label = "99+"
+	}
+	return " " + lipgloss.NewStyle().
+		Background(colorNotif).
+		Foreground(colorBg).
+		Bold(true).
+		Padding(0, 1).
+		Render(label)
+}
+
+// formatReplyQuote renders the quoted parent line shown above a reply.
+// parent is nil when the parent is not in the current view.
+func formatReplyQuote(parentID string, parent *ChatMessage) string {
+	snippet := "#" + parentID
+	if parent != nil {
+		content := parent.content
+		if parent.deleted {
+			content = "message deleted"
+		}
+		snippet = fmt.Sprintf("#%s %s: %s", parentID, parent.sender, truncate(strings.ReplaceAll(content, "\n", " "), 50))
+	}
+	return styleMuted.Render("  ╭ " + snippet)
+}
+
+// formatEdited renders the "(edited)" marker for edited messages.
+func formatEdited(edited bool) string {
+	if !edited {
+		return ""
+	}
+	return styleMuted.Render(" (edited)")
+}
+
+// formatMessageID renders the "#42 " prefix used to address a message.
+func formatMessageID(id string, style lipgloss.Style) string {
+	if id == "" {
+		return ""
+	}
+	return style.Render("#"+id) + " "
+}
+
+// formatExpiry renders an RFC 3339 time as local "Jan 2 15:04"
+func formatExpiry(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.Local().Format("Jan 2 15:04")
+}
+
 func shortTimestamp(ts string) string {
 	if len(ts) >= 16 {
 		return ts[11:16]
@@ -548,5 +760,3 @@ func truncate(s string, max int) string {
 	runes := []rune(s)
 	return string(runes[:max-1]) + "…"
 }
-
-var _ = truncate
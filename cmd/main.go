@@ -1,42 +1,79 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"log"
 	"log/slog"
 	_ "net/http/pprof"
+	"os"
 	"termchat/client"
 	"termchat/server"
 )
 
 func main() {
-	// Mode: "server" (default) or "client" (TUI) or "send" (CLI)
-	mode := flag.String("mode", "server", "run mode: server | client | send")
+	// Mode: "server" (default) or "client" (TUI) or "send" (CLI) or "reindex" or "admin"
+	mode := flag.String("mode", "server", "run mode: server | client | send | reindex | admin")
 	host := flag.String("host", "localhost", "server host (client/send mode only)")
 	port := flag.String("port", "9000", "TCP port (client/send mode only)")
+	plaintext := flag.Bool("plaintext", false, "connect without TLS, for servers with allow_plaintext (client/send mode only)")
+	flag.Bool("tls", true, "connect over TLS, the default; kept for older scripts (client/send mode only)")
+	caFile := flag.String("ca", "", "pin the server to this CA certificate (client/send mode only)")
+	certFile := flag.String("cert", "", "client certificate for servers that require one (client/send mode only)")
+	keyFile := flag.String("key", "", "client certificate key (client/send mode only)")
 
 	// Send mode flags
 	email := flag.String("email", "", "user email (send mode only)")
-	pass := flag.String("pass", "", "user password (send mode only)")
+	pass := flag.String("pass", "", "user password (send mode only, or $TERMCHAT_PASS; omit to reuse the saved session)")
 	to := flag.String("to", "", "recipient (@user or room name) (send mode only)")
 	msg := flag.String("msg", "", "message content (send mode only, or pipe to stdin)")
 
+	// Admin mode flags
+	revoke := flag.Bool("revoke", false, "take the admin flag away instead (admin mode only)")
+
 	// Server flags (existing)
 	envType := flag.String("env", "dev", "set the env type to dev or prod or staging")
 	flag.Parse()
 
+	// TLS unless plaintext was asked for explicitly, matching the server
+	var tlsCfg *tls.Config
+	if *plaintext && (*caFile != "" || *certFile != "" || *keyFile != "") {
+		log.Fatalf("--plaintext cannot be combined with --ca, --cert or --key")
+	}
+	if !*plaintext {
+		cfg, err := client.TLSConfig(*host, *caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("tls error: %v", err)
+		}
+		tlsCfg = cfg
+	}
+
 	switch *mode {
 	case "client":
-		if err := client.RunClient(*host, *port); err != nil {
+		if err := client.RunClient(*host, *port, tlsCfg); err != nil {
 			log.Fatalf("client error: %v", err)
 		}
 	case "send":
-		if *email == "" || *pass == "" || *to == "" {
-			log.Fatalf("Usage: termchat --mode send --email <email> --pass <pass> --to <recipient> [--msg <message>]")
+		if *pass == "" {
+			*pass = os.Getenv("TERMCHAT_PASS")
 		}
-		if err := client.SendCLI(*host, *port, *email, *pass, *to, *msg); err != nil {
+		if *to == "" || (*pass != "" && *email == "") {
+			log.Fatalf("Usage: termchat --mode send [--email <email> --pass <pass>] --to <recipient> [--msg <message>]")
+		}
+		if err := client.SendCLI(*host, *port, tlsCfg, *email, *pass, *to, *msg); err != nil {
 			log.Fatalf("send error: %v", err)
 		}
+	case "reindex":
+		if err := server.Reindex(envType); err != nil {
+			log.Fatalf("reindex error: %v", err)
+		}
+	case "admin":
+		if *email == "" {
+			log.Fatalf("Usage: termchat --mode admin --email <email> [--revoke]")
+		}
+		if err := server.SetAdmin(envType, *email, !*revoke); err != nil {
+			log.Fatalf("admin error: %v", err)
+		}
 	default:
 		slog.Info("Running in", "env", *envType)
 		server.Run(envType)
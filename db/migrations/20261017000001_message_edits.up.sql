@@ -0,0 +1,12 @@
+-- track when a message was last edited
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+-- message_edits table: prior revisions of edited messages (encrypted like messages.content)
+CREATE TABLE message_edits (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages(id),
+    content TEXT NOT NULL,
+    edited_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_message_edits_message_id ON message_edits (message_id);
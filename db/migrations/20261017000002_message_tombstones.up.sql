@@ -0,0 +1,4 @@
+-- soft delete: the row stays as a tombstone so history ordering is kept,
+-- but its ciphertext is wiped
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN deleted_by BIGINT REFERENCES users(id);
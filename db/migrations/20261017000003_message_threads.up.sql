@@ -0,0 +1,3 @@
+-- threaded replies: a reply points at the message it answers
+ALTER TABLE messages ADD COLUMN parent_id BIGINT REFERENCES messages(id) ON DELETE SET NULL;
+CREATE INDEX idx_messages_parent_id ON messages(parent_id);
@@ -0,0 +1,15 @@
+-- per-user read pointer for each conversation, used for unread counts
+CREATE TABLE chat_reads (
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    chat_type VARCHAR(10) NOT NULL,
+    chat_id BIGINT NOT NULL,
+    last_read_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chat_type, chat_id)
+);
+
+-- seed pointers from receipts recorded so far
+INSERT INTO chat_reads (user_id, chat_type, chat_id, last_read_id)
+SELECT r.user_id, m.chat_type, m.chat_id, MAX(m.id)
+FROM messages m, unnest(m.read_by) AS r(user_id)
+GROUP BY r.user_id, m.chat_type, m.chat_id;
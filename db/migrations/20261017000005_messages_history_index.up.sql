@@ -0,0 +1,2 @@
+-- keyset pagination: WHERE chat_type = ? AND chat_id = ? AND id < ? ORDER BY id DESC
+CREATE INDEX idx_messages_chat_id_desc ON messages(chat_type, chat_id, id DESC);
@@ -0,0 +1,8 @@
+-- blinded search index: one HMAC digest per distinct word of a message, so
+-- /find can match words without readable text at rest
+CREATE TABLE message_tokens (
+    token CHAR(64) NOT NULL,
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    PRIMARY KEY (token, message_id)
+);
+CREATE INDEX idx_message_tokens_message_id ON message_tokens(message_id);
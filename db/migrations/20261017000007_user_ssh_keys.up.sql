@@ -0,0 +1,9 @@
+-- public keys users registered for logging in over SSH
+CREATE TABLE user_ssh_keys (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(100) NOT NULL UNIQUE,
+    public_key TEXT NOT NULL, -- authorized_keys line, including the comment
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_user_ssh_keys_user_id ON user_ssh_keys(user_id);
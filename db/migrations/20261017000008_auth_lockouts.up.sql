@@ -0,0 +1,11 @@
+-- audit trail of accounts and addresses locked out after failed logins
+CREATE TABLE auth_lockouts (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL, -- 'account', 'ip' or 'register'
+    subject VARCHAR(255) NOT NULL, -- email or IP address
+    ip VARCHAR(64) NOT NULL,
+    failures INT NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_auth_lockouts_subject ON auth_lockouts(subject);
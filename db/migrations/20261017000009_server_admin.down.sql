@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_bans;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,10 @@
+-- server-wide administrators and the bans they hand out
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE user_bans (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    banned_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    banned_until TIMESTAMP, -- NULL bans for good
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
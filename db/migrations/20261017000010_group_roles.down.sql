@@ -0,0 +1,3 @@
+ALTER TABLE group_chats DROP COLUMN IF EXISTS pinned_message_id;
+ALTER TABLE group_members DROP CONSTRAINT IF EXISTS group_members_role_check;
+UPDATE group_members SET role = 'member' WHERE role = 'owner';
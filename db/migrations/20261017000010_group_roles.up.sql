@@ -0,0 +1,11 @@
+-- group roles: owner, admin, moderator, member; owners get their own role
+UPDATE group_members gm SET role = 'owner'
+FROM group_chats g
+WHERE g.id = gm.group_id AND g.owner_id = gm.user_id;
+UPDATE group_members SET role = 'member'
+WHERE role NOT IN ('owner', 'admin', 'moderator', 'member');
+ALTER TABLE group_members ADD CONSTRAINT group_members_role_check
+    CHECK (role IN ('owner', 'admin', 'moderator', 'member'));
+
+-- pinned message of a group, set with /pin
+ALTER TABLE group_chats ADD COLUMN pinned_message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL;
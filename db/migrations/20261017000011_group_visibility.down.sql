@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS group_invites;
+DROP TABLE IF EXISTS group_join_requests;
+ALTER TABLE group_chats DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,20 @@
+-- who may /join a group: anyone, by approved request, or by invite only
+ALTER TABLE group_chats ADD COLUMN visibility VARCHAR(12) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'private', 'invite_only'));
+
+-- pending /join requests for private groups
+CREATE TABLE group_join_requests (
+    group_id BIGINT NOT NULL REFERENCES group_chats(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+-- outstanding /invite invitations to private and invite-only groups
+CREATE TABLE group_invites (
+    group_id BIGINT NOT NULL REFERENCES group_chats(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
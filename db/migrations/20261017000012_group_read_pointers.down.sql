@@ -0,0 +1,2 @@
+-- group read_by arrays are not restored; chat_reads still holds every pointer
+DROP INDEX IF EXISTS idx_chat_reads_chat;
@@ -0,0 +1,4 @@
+-- group "seen by" markers come from chat_reads; read_by is kept for personal chats only
+CREATE INDEX IF NOT EXISTS idx_chat_reads_chat ON chat_reads (chat_type, chat_id, last_read_id);
+
+UPDATE messages SET read_by = NULL WHERE chat_type = 'group' AND read_by IS NOT NULL;
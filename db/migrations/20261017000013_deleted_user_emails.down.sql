@@ -0,0 +1,2 @@
+UPDATE users SET email = NULL
+WHERE email = 'deleted-' || id || '@invalid';
@@ -0,0 +1,3 @@
+-- anonymized accounts keep a placeholder email instead of NULL
+UPDATE users SET email = 'deleted-' || id || '@invalid'
+WHERE email IS NULL AND username = 'deleted-' || id;
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"termchat/factory"
+	"time"
+)
+
+// ExportAccount gathers the user's profile, sent messages (decrypted),
+// reactions, memberships, chats and SSH keys.
+func (p *Postgres) ExportAccount(userID int) (factory.AccountExport, error) {
+	export := factory.AccountExport{ExportedAt: time.Now().Format(time.RFC3339)}
+
+	var createdAt time.Time
+	var lastLogin sql.NullTime
+	var email sql.NullString
+	err := p.DbConn.QueryRow(`
+		SELECT id, email, username, created_at, last_login FROM users WHERE id = $1
+	`, userID).Scan(&export.Profile.ID, &email, &export.Profile.Name, &createdAt, &lastLogin)
+	if err != nil {
+		return export, fmt.Errorf("failed to load profile: %w", err)
+	}
+	export.Profile.Email = email.String
+	export.Profile.Created = createdAt.Format(time.RFC3339)
+	if lastLogin.Valid {
+		export.Profile.LastLogin = lastLogin.Time.Format("2006-01-02 15:04:05")
+	}
+
+	key, err := getEncryptionKey()
+	if err != nil {
+		return export, err
+	}
+	rows, err := p.DbConn.Query(`
+		SELECT `+messageColumns+`
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.sender_id = $1
+		ORDER BY m.id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export messages: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		msg, err := scanMessage(rows, key)
+		if err != nil {
+			return export, fmt.Errorf("failed to scan message: %w", err)
+		}
+		export.Messages = append(export.Messages, msg)
+	}
+
+	reactions, err := p.DbConn.Query(`
+		SELECT message_id, emoji, created_at FROM reactions WHERE user_id = $1 ORDER BY id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export reactions: %w", err)
+	}
+	defer reactions.Close()
+	for reactions.Next() {
+		var r factory.ExportedReaction
+		var created time.Time
+		if err := reactions.Scan(&r.MessageID, &r.Emoji, &created); err != nil {
+			return export, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		r.Created = created.Format(time.RFC3339)
+		export.Reactions = append(export.Reactions, r)
+	}
+
+	groups, err := p.DbConn.Query(`
+		SELECT g.name, gm.role, gm.joined_at
+		FROM group_members gm JOIN group_chats g ON g.id = gm.group_id
+		WHERE gm.user_id = $1 ORDER BY gm.joined_at
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export memberships: %w", err)
+	}
+	defer groups.Close()
+	for groups.Next() {
+		var g factory.GroupMembership
+		var joined time.Time
+		if err := groups.Scan(&g.Group, &g.Role, &joined); err != nil {
+			return export, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		g.JoinedAt = joined.Format(time.RFC3339)
+		export.Memberships = append(export.Memberships, g)
+	}
+
+	chats, err := p.DbConn.Query(`
+		SELECT u.username
+		FROM personal_chats pc
+		JOIN users u ON u.id = CASE WHEN pc.user1_id = $1 THEN pc.user2_id ELSE pc.user1_id END
+		WHERE pc.user1_id = $1 OR pc.user2_id = $1
+		ORDER BY u.username
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export chats: %w", err)
+	}
+	defer chats.Close()
+	for chats.Next() {
+		var partner string
+		if err := chats.Scan(&partner); err != nil {
+			return export, fmt.Errorf("failed to scan chat: %w", err)
+		}
+		export.Chats = append(export.Chats, partner)
+	}
+
+	export.SSHKeys, err = p.GetSSHKeys(userID)
+	return export, err
+}
+
+// DeleteAccount removes a user. The row stays behind as an anonymous
+// "deleted-<id>" tombstone with the profile scrubbed (the email becomes an
+// unroutable placeholder, since lookups expect one), so chats and replies
+// that point at it keep working. With purge the user's own messages and
+// reactions go too; their chat partners keep their side of the history.
+// Groups the user owned are handed over as if they had left them.
+func (p *Postgres) DeleteAccount(userID int, purge bool) error {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM group_members WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete account: %w", err)
+	}
+	rows, err := tx.Query(`SELECT id FROM group_chats WHERE owner_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete account: %w", err)
+	}
+	var owned []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+		owned = append(owned, id)
+	}
+	rows.Close()
+	for _, id := range owned {
+		if _, err := handOverGroup(tx, id); err != nil {
+			return err
+		}
+	}
+
+	steps := []string{
+		`DELETE FROM chat_reads WHERE user_id = $1`,
+		`DELETE FROM user_ssh_keys WHERE user_id = $1`,
+		`DELETE FROM group_join_requests WHERE user_id = $1`,
+		`DELETE FROM group_invites WHERE user_id = $1`,
+		`UPDATE messages SET read_by = array_remove(read_by, $1) WHERE $1 = ANY(read_by)`,
+		`UPDATE messages SET deleted_by = NULL WHERE deleted_by = $1`,
+	}
+	if purge {
+		steps = append(steps,
+			`DELETE FROM reactions
+			WHERE user_id = $1 OR message_id IN (SELECT id FROM messages WHERE sender_id = $1)`,
+			`DELETE FROM message_edits WHERE message_id IN (SELECT id FROM messages WHERE sender_id = $1)`,
+			`DELETE FROM messages WHERE sender_id = $1`,
+			// Only chats with nothing left on either side are dropped
+			`DELETE FROM personal_chats pc
+			WHERE (pc.user1_id = $1 OR pc.user2_id = $1)
+			  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.chat_type = 'personal' AND m.chat_id = pc.id)`,
+		)
+	}
+	steps = append(steps,
+		`UPDATE users SET username = 'deleted-' || id, email = 'deleted-' || id || '@invalid',
+			password_hash = '', last_login = NULL
+		WHERE id = $1`,
+	)
+	for _, q := range steps {
+		if _, err := tx.Exec(q, userID); err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"termchat/factory"
+	"testing"
+	"time"
+)
+
+// testPostgres connects to the migrated database at $POSTGRES_URL, skipping
+// the test when it is not set.
+func testPostgres(t *testing.T) *Postgres {
+	t.Helper()
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		t.Skip("POSTGRES_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("invalid POSTGRES_URL: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Postgres{DbConn: db}
+}
+
+func TestAnonymizedAccountStaysSearchable(t *testing.T) {
+	p := testPostgres(t)
+
+	suffix := time.Now().UnixNano()
+	email := fmt.Sprintf("anon-%d@example.com", suffix)
+	err := p.CreateUser(factory.User{
+		Email:          email,
+		Name:           fmt.Sprintf("anon%d", suffix),
+		HashedPassword: "x",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := p.GetUser(email)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if err := p.DeleteAccount(int(user.ID), false); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	name := fmt.Sprintf("deleted-%d", user.ID)
+	found, err := p.SearchUsersByName(name)
+	if err != nil {
+		t.Fatalf("SearchUsersByName: %v", err)
+	}
+	if len(found) == 0 || found[0].Name != name {
+		t.Fatalf("SearchUsersByName(%q) = %v, want the anonymized user", name, found)
+	}
+
+	got, err := p.GetUserByUsername(name)
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Fatalf("GetUserByUsername(%q) returned user %d, want %d", name, got.ID, user.ID)
+	}
+}
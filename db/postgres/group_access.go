@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// SetGroupVisibility changes who may join the group
+func (p *Postgres) SetGroupVisibility(groupID int, visibility string) error {
+	_, err := p.DbConn.Exec(`
+		UPDATE group_chats SET visibility = $2, updated_at = NOW() WHERE id = $1
+	`, groupID, visibility)
+	if err != nil {
+		return fmt.Errorf("failed to set visibility: %w", err)
+	}
+	return nil
+}
+
+// AddGroupInvite records an invitation for the user to join the group
+func (p *Postgres) AddGroupInvite(groupID, userID, invitedBy int) error {
+	_, err := p.DbConn.Exec(`
+		INSERT INTO group_invites (group_id, user_id, invited_by) VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET invited_by = EXCLUDED.invited_by, created_at = NOW()
+	`, groupID, userID, invitedBy)
+	if err != nil {
+		return fmt.Errorf("failed to store invite: %w", err)
+	}
+	return nil
+}
+
+// TakeGroupInvite uses up the user's invitation to the group and reports
+// whether there was one.
+func (p *Postgres) TakeGroupInvite(groupID, userID int) (bool, error) {
+	res, err := p.DbConn.Exec(`DELETE FROM group_invites WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check invite: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// AddJoinRequest files a request to join a private group
+func (p *Postgres) AddJoinRequest(groupID, userID int) error {
+	_, err := p.DbConn.Exec(`
+		INSERT INTO group_join_requests (group_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store join request: %w", err)
+	}
+	return nil
+}
+
+// TakeJoinRequest removes a pending join request and reports whether there
+// was one.
+func (p *Postgres) TakeJoinRequest(groupID, userID int) (bool, error) {
+	res, err := p.DbConn.Exec(`DELETE FROM group_join_requests WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to take join request: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// GetJoinRequests lists who asked to join the group, oldest first
+func (p *Postgres) GetJoinRequests(groupID int) ([]string, error) {
+	return p.groupUsernames(`
+		SELECT u.username FROM group_join_requests r JOIN users u ON u.id = r.user_id
+		WHERE r.group_id = $1 ORDER BY r.created_at
+	`, groupID)
+}
+
+// GetGroupManagers lists the group's owner and admins
+func (p *Postgres) GetGroupManagers(groupID int) ([]string, error) {
+	return p.groupUsernames(`
+		SELECT u.username FROM group_members gm JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = $1 AND gm.role IN ('owner', 'admin')
+	`, groupID)
+}
+
+func (p *Postgres) groupUsernames(query string, groupID int) ([]string, error) {
+	rows, err := p.DbConn.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
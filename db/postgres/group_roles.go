@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"termchat/factory"
+)
+
+// GetGroupRole returns the user's role in the group, empty if they are not
+// a member.
+func (p *Postgres) GetGroupRole(userID, groupID int) (string, error) {
+	var role string
+	err := p.DbConn.QueryRow(`
+		SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2
+	`, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get group role: %w", err)
+	}
+	return role, nil
+}
+
+// SetGroupRole changes a member's role
+func (p *Postgres) SetGroupRole(userID, groupID int, role string) error {
+	res, err := p.DbConn.Exec(`
+		UPDATE group_members SET role = $3 WHERE group_id = $1 AND user_id = $2
+	`, groupID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to set group role: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("not a member of the group")
+	}
+	return nil
+}
+
+// GetGroupChat returns a group with its topic (description), pin and
+// visibility
+func (p *Postgres) GetGroupChat(groupID int) (factory.GroupChat, error) {
+	var g factory.GroupChat
+	var desc sql.NullString
+	var ownerID, pinned sql.NullInt64
+	err := p.DbConn.QueryRow(`
+		SELECT id, name, description, owner_id, is_global, pinned_message_id, visibility
+		FROM group_chats WHERE id = $1
+	`, groupID).Scan(&g.ID, &g.Name, &desc, &ownerID, &g.IsGlobal, &pinned, &g.Visibility)
+	if err != nil {
+		return g, fmt.Errorf("failed to get group: %w", err)
+	}
+	g.Description = desc.String
+	g.OwnerID = int(ownerID.Int64)
+	g.PinnedMessageID = int(pinned.Int64)
+	return g, nil
+}
+
+// SetGroupTopic replaces the group's topic
+func (p *Postgres) SetGroupTopic(groupID int, topic string) error {
+	_, err := p.DbConn.Exec(`
+		UPDATE group_chats SET description = $2, updated_at = NOW() WHERE id = $1
+	`, groupID, topic)
+	if err != nil {
+		return fmt.Errorf("failed to set topic: %w", err)
+	}
+	return nil
+}
+
+// SetPinnedMessage pins a message in the group, or unpins with messageID 0
+func (p *Postgres) SetPinnedMessage(groupID, messageID int) error {
+	pinned := sql.NullInt64{Int64: int64(messageID), Valid: messageID != 0}
+	_, err := p.DbConn.Exec(`
+		UPDATE group_chats SET pinned_message_id = $2 WHERE id = $1
+	`, groupID, pinned)
+	if err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	return nil
+}
+
+// LeaveGroupChat removes a user from a group chat. When the owner leaves,
+// the group passes to the member that handOverGroup picks, whose name is
+// returned; otherwise the name is empty.
+func (p *Postgres) LeaveGroupChat(userID, groupID int) (string, error) {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID); err != nil {
+		return "", fmt.Errorf("failed to leave group: %w", err)
+	}
+	var ownerID sql.NullInt64
+	if err := tx.QueryRow(`SELECT owner_id FROM group_chats WHERE id = $1 FOR UPDATE`, groupID).Scan(&ownerID); err != nil {
+		return "", fmt.Errorf("failed to leave group: %w", err)
+	}
+	heir := ""
+	if ownerID.Valid && int(ownerID.Int64) == userID {
+		if heir, err = handOverGroup(tx, groupID); err != nil {
+			return "", err
+		}
+	}
+	return heir, tx.Commit()
+}
+
+// TransferGroupOwnership makes toID the owner of the group; the old owner
+// stays on as an admin.
+func (p *Postgres) TransferGroupOwnership(groupID, fromID, toID int) error {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID sql.NullInt64
+	if err := tx.QueryRow(`SELECT owner_id FROM group_chats WHERE id = $1 FOR UPDATE`, groupID).Scan(&ownerID); err != nil {
+		return fmt.Errorf("failed to transfer group: %w", err)
+	}
+	if !ownerID.Valid || int(ownerID.Int64) != fromID {
+		return fmt.Errorf("not the group owner")
+	}
+	res, err := tx.Exec(`UPDATE group_members SET role = 'owner' WHERE group_id = $1 AND user_id = $2`, groupID, toID)
+	if err != nil {
+		return fmt.Errorf("failed to transfer group: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("not a member of the group")
+	}
+	if _, err := tx.Exec(`UPDATE group_members SET role = 'admin' WHERE group_id = $1 AND user_id = $2`, groupID, fromID); err != nil {
+		return fmt.Errorf("failed to transfer group: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_chats SET owner_id = $2, updated_at = NOW() WHERE id = $1`, groupID, toID); err != nil {
+		return fmt.Errorf("failed to transfer group: %w", err)
+	}
+	return tx.Commit()
+}
+
+// handOverGroup gives a group whose owner is gone to the longest-standing
+// admin, failing that moderator, failing that member, and returns their
+// name. A group nobody is left in keeps no owner.
+func handOverGroup(tx *sql.Tx, groupID int) (string, error) {
+	var heirID int
+	var heir string
+	err := tx.QueryRow(`
+		SELECT gm.user_id, u.username
+		FROM group_members gm JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = $1
+		ORDER BY CASE gm.role WHEN 'admin' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END,
+			gm.joined_at, gm.user_id
+		LIMIT 1
+	`, groupID).Scan(&heirID, &heir)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(`UPDATE group_chats SET owner_id = NULL, updated_at = NOW() WHERE id = $1`, groupID)
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to pick new owner: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_chats SET owner_id = $2, updated_at = NOW() WHERE id = $1`, groupID, heirID); err != nil {
+		return "", fmt.Errorf("failed to hand over group: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_members SET role = 'owner' WHERE group_id = $1 AND user_id = $2`, groupID, heirID); err != nil {
+		return "", fmt.Errorf("failed to hand over group: %w", err)
+	}
+	return heir, nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
 	"termchat/db/redis"
 	"termchat/factory"
+	msgpkg "termchat/pkg/message"
+	"termchat/pkg/protocol"
 	"termchat/utils"
 	"time"
 
@@ -75,69 +79,84 @@ func getEncryptionKey() ([]byte, error) {
 	return key, nil
 }
 
-// SendPersonalMessage encrypts the message using AES-256 and stores it
-func (p *Postgres) SendPersonalMessage(senderUsername, receiverUsername, message, sessionID string) error {
+// SendPersonalMessage encrypts the message using AES-256, stores it and
+// returns the new message ID. parentID is the message being replied to, or 0.
+func (p *Postgres) SendPersonalMessage(senderUsername, receiverUsername, message string, parentID int, sessionID string) (int, error) {
 	var senderID, receiverID int
 
 	// Step 1: Get user IDs
 	err := p.DbConn.QueryRow("SELECT id FROM users WHERE username = $1", senderUsername).Scan(&senderID)
 	if err != nil {
-		return fmt.Errorf("sender '%s' not found: %w", senderUsername, err)
+		return 0, fmt.Errorf("sender '%s' not found: %w", senderUsername, err)
 	}
 	err = p.DbConn.QueryRow("SELECT id FROM users WHERE username = $1", receiverUsername).Scan(&receiverID)
 	if err != nil {
-		return fmt.Errorf("receiver '%s' not found: %w", receiverUsername, err)
+		return 0, fmt.Errorf("receiver '%s' not found: %w", receiverUsername, err)
 	}
 
 	// Step 2: Get or create personal chat
 	chatID, err := p.CreatePersonalChat(senderID, receiverID)
 	if err != nil {
-		return fmt.Errorf("failed to get/create chat: %w", err)
+		return 0, fmt.Errorf("failed to get/create chat: %w", err)
 	}
 
 	// Step 3: Load encryption key
 	key, err := getEncryptionKey()
 	if err != nil {
-		return fmt.Errorf("failed to get encryption key: %w", err)
+		return 0, fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
 	// Step 4: Encrypt the message before storing in DB
 	encrypted, err := utils.EncryptAES256(message, key)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt message: %w", err)
+		return 0, fmt.Errorf("failed to encrypt message: %w", err)
 	}
 
 	// Step 5: Insert into DB
 	query := `
-		INSERT INTO messages (sender_id, chat_type, chat_id, content, sent_at)
-		VALUES ($1, 'personal', $2, $3, NOW())
+		INSERT INTO messages (sender_id, chat_type, chat_id, content, sent_at, parent_id)
+		VALUES ($1, 'personal', $2, $3, NOW(), $4)
+		RETURNING id, sent_at
 	`
-	_, err = p.DbConn.Exec(query, senderID, chatID, encrypted)
+	var messageID int
+	var sentAt time.Time
+	err = p.DbConn.QueryRow(query, senderID, chatID, encrypted, nullableID(parentID)).Scan(&messageID, &sentAt)
 	if err != nil {
-		return fmt.Errorf("failed to insert encrypted message: %w", err)
+		return 0, fmt.Errorf("failed to insert encrypted message: %w", err)
+	}
+	if err := indexMessage(p.DbConn, messageID, message, key); err != nil {
+		slog.Error("Failed to index message", "id", messageID, "error", err)
 	}
 
 	// Step 6: Publish to Redis so live chat works
-	// Payload format: <sessionID>|<senderUsername>|<timestamp>|<message>
-	payload := fmt.Sprintf("%s|%s|%s|%s",
-		sessionID,
-		senderUsername,
-		time.Now().Format("2006-01-02 15:04:05"),
-		message, // plaintext so receiver can read immediately
-	)
+	event := factory.ChatEvent{
+		Type:      "MSG",
+		SessionID: sessionID,
+		Sender:    senderUsername,
+		MessageID: messageID,
+		SentAt:    sentAt.Format("2006-01-02 15:04:05"),
+		Content:   message, // plaintext so receiver can read immediately
+		ParentID:  parentID,
+	}
+	if err := publishChatEvent(fmt.Sprintf("chat:%d", chatID), event); err != nil {
+		return messageID, fmt.Errorf("failed to publish message to Redis: %w", err)
+	}
 
-	ctx := context.Background()
-	channel := fmt.Sprintf("chat:%d", chatID)
+	return messageID, nil
+}
 
-	if err := redis.NewRedis(nil).Client.Publish(ctx, channel, payload).Err(); err != nil {
-		return fmt.Errorf("failed to publish message to Redis: %w", err)
+// publishChatEvent publishes a JSON encoded event on a chat or group channel
+func publishChatEvent(channel string, event factory.ChatEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return redis.NewRedis(nil).Client.Publish(context.Background(), channel, payload).Err()
 }
 
-// GetMessagesBetweenUsers retrieves and decrypts messages between two users
-func (p *Postgres) GetMessagesBetweenUsers(username1, username2 string) ([]factory.Message, error) {
+// GetMessagesBetweenUsers retrieves and decrypts the latest messages between
+// two users. See GetMessagesBefore for beforeID and limit.
+func (p *Postgres) GetMessagesBetweenUsers(username1, username2 string, beforeID, limit int) ([]factory.Message, error) {
 	var user1ID, user2ID int
 
 	// Step 1: Get user IDs
@@ -156,27 +175,28 @@ func (p *Postgres) GetMessagesBetweenUsers(username1, username2 string) ([]facto
 		return nil, fmt.Errorf("failed to get/create chat: %w", err)
 	}
 
-	// Step 3: Load encryption key from Viper
-	key, err := getEncryptionKey()
+	// Step 3: Fetch the page
+	return p.GetMessagesBefore("personal", chatID, beforeID, limit)
+}
 
+// GetMessagesBefore returns up to limit messages of a chat with an ID below
+// beforeID (0 means from the newest), oldest first. Paging on the primary key
+// keeps every page an index range scan, however long the history is.
+func (p *Postgres) GetMessagesBefore(chatType string, chatID, beforeID, limit int) ([]factory.Message, error) {
+	key, err := getEncryptionKey()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
-	// Check if the key is valid
-	if len(key) != 32 {
-		return nil, fmt.Errorf("encryption key must be exactly 32 bytes, got %d bytes", len(key))
-	}
-
-	// Step 4: Query messages
 	query := `
-		SELECT id, sender_id, content, sent_at
-		FROM messages
-		WHERE chat_type = 'personal' AND chat_id = $1
-		ORDER BY sent_at ASC
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.chat_type = $1 AND m.chat_id = $2 AND ($3 = 0 OR m.id < $3)
+		ORDER BY m.id DESC
+		LIMIT $4
 	`
-
-	rows, err := p.DbConn.Query(query, chatID)
+	rows, err := p.DbConn.Query(query, chatType, chatID, beforeID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch messages: %w", err)
 	}
@@ -184,28 +204,18 @@ func (p *Postgres) GetMessagesBetweenUsers(username1, username2 string) ([]facto
 
 	var messages []factory.Message
 	for rows.Next() {
-		var msg factory.Message
-		var encrypted string
-		var sentAt time.Time
-
-		err := rows.Scan(&msg.ID, &msg.SenderID, &encrypted, &sentAt)
+		msg, err := scanMessage(rows, key)
 		if err != nil {
 			return nil, fmt.Errorf("row scan failed: %w", err)
 		}
-
-		decrypted, err := utils.DecryptAES256(encrypted, key)
-		if err != nil {
-			msg.Content = "[decryption failed]"
-		} else {
-			msg.Content = decrypted
-		}
-
-		msg.ChatID = chatID
-		msg.SentAt = sentAt.Format("2006-01-02 15:04:05")
-		msg.ChatType = "personal"
 		messages = append(messages, msg)
 	}
 
+	// Newest first from the query, callers want chronological order
+	for l, r := 0, len(messages)-1; l < r; l, r = l+1, r-1 {
+		messages[l], messages[r] = messages[r], messages[l]
+	}
+
 	p.fetchReactionsForMessages(messages)
 	return messages, nil
 }
@@ -238,6 +248,76 @@ func (p *Postgres) GetChatPartners(userID int) ([]string, error) {
 	return partners, nil
 }
 
+// GetRoomSummaries lists the user's personal chats and groups with their
+// unread count and last message, most recently active first
+func (p *Postgres) GetRoomSummaries(userID int) ([]factory.RoomSummary, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH rooms AS (
+			SELECT 'personal' AS chat_type, pc.id AS chat_id, u.username AS name, u.last_login
+			FROM personal_chats pc
+			JOIN users u ON u.id = CASE WHEN pc.user1_id = $1 THEN pc.user2_id ELSE pc.user1_id END
+			WHERE pc.user1_id = $1 OR pc.user2_id = $1
+			UNION ALL
+			SELECT 'group', g.id, g.name, NULL::TIMESTAMP
+			FROM group_chats g
+			JOIN group_members gm ON gm.group_id = g.id
+			WHERE gm.user_id = $1
+		)
+		SELECT r.chat_type, r.chat_id, r.name, r.last_login,
+			(SELECT COUNT(*) FROM messages m
+			 WHERE m.chat_type = r.chat_type AND m.chat_id = r.chat_id
+			   AND m.id > COALESCE(cr.last_read_id, 0)
+			   AND m.sender_id <> $1 AND m.deleted_at IS NULL),
+			last.sent_at, last.username, last.content, last.deleted_at
+		FROM rooms r
+		LEFT JOIN chat_reads cr
+			ON cr.user_id = $1 AND cr.chat_type = r.chat_type AND cr.chat_id = r.chat_id
+		LEFT JOIN LATERAL (
+			SELECT m.sent_at, u.username, m.content, m.deleted_at
+			FROM messages m
+			JOIN users u ON u.id = m.sender_id
+			WHERE m.chat_type = r.chat_type AND m.chat_id = r.chat_id
+			ORDER BY m.sent_at DESC, m.id DESC
+			LIMIT 1
+		) last ON TRUE
+		ORDER BY last.sent_at DESC NULLS LAST, r.name ASC
+	`
+	rows, err := p.DbConn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rooms: %w", err)
+	}
+	defer rows.Close()
+
+	var rooms []factory.RoomSummary
+	for rows.Next() {
+		var r factory.RoomSummary
+		var lastLogin, lastAt, deletedAt sql.NullTime
+		var lastSender, content sql.NullString
+		if err := rows.Scan(&r.ChatType, &r.ChatID, &r.Name, &lastLogin, &r.Unread, &lastAt, &lastSender, &content, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan room: %w", err)
+		}
+		if lastLogin.Valid {
+			r.LastSeen = lastLogin.Time.Format("2006-01-02 15:04:05")
+		}
+		if lastAt.Valid {
+			r.LastAt = lastAt.Time.Format("2006-01-02 15:04:05")
+			r.LastSender = lastSender.String
+			if deletedAt.Valid {
+				r.Preview = "message deleted"
+			} else if decrypted, err := utils.DecryptAES256(content.String, key); err == nil {
+				r.Preview = decrypted
+			}
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms, nil
+}
+
 // GetMessagesAfter returns new decrypted messages after a given time
 func (p *Postgres) GetMessagesAfter(user1, user2 string, since time.Time) ([]*factory.Message, error) {
 	var user1ID, user2ID int
@@ -410,8 +490,10 @@ func (p *Postgres) CreateGroupChat(name, description string, ownerID int) (int,
 		return 0, fmt.Errorf("failed to create group chat: %w", err)
 	}
 
-	// Owner joins as an admin
-	err = p.JoinGroupChat(ownerID, groupID)
+	// Owner joins with the owner role
+	_, err = p.DbConn.Exec(`
+		INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, 'owner')
+	`, groupID, ownerID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to join group chat as owner: %w", err)
 	}
@@ -426,79 +508,43 @@ func (p *Postgres) JoinGroupChat(userID, groupID int) error {
 		VALUES ($1, $2, 'member')
 		ON CONFLICT (group_id, user_id) DO NOTHING
 	`
-	// If it was already there, no problem. If owner, we might want to set role to owner.
-	// But the migration says role defaults to 'member'.
+	// If it was already there, no problem; their role is kept.
 	_, err := p.DbConn.Exec(query, groupID, userID)
 	return err
 }
 
-// LeaveGroupChat removes a user from a group chat
-func (p *Postgres) LeaveGroupChat(userID, groupID int) error {
-	query := `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`
-	_, err := p.DbConn.Exec(query, groupID, userID)
-	return err
+// GetGroupChatMessages retrieves the latest decrypted messages for a group.
+// See GetMessagesBefore for beforeID and limit.
+func (p *Postgres) GetGroupChatMessages(groupID, beforeID, limit int) ([]factory.Message, error) {
+	return p.GetMessagesBefore("group", groupID, beforeID, limit)
 }
 
-// GetGroupChatMessages retrieves decrypted messages for a group
-func (p *Postgres) GetGroupChatMessages(groupID int) ([]factory.Message, error) {
+// SendGroupMessage encrypts and stores a message for a group and returns
+// the new message ID. parentID is the message being replied to, or 0.
+func (p *Postgres) SendGroupMessage(senderID, groupID int, message string, parentID int, sessionID string) (int, error) {
 	key, err := getEncryptionKey()
 	if err != nil {
-		return nil, err
-	}
-
-	query := `
-		SELECT m.id, m.sender_id, u.username, m.content, m.sent_at
-		FROM messages m
-		JOIN users u ON u.id = m.sender_id
-		WHERE m.chat_type = 'group' AND m.chat_id = $1
-		ORDER BY m.sent_at ASC
-	`
-	rows, err := p.DbConn.Query(query, groupID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var messages []factory.Message
-	for rows.Next() {
-		var msg factory.Message
-		var encrypted string
-		var sentAt time.Time
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &encrypted, &sentAt); err != nil {
-			return nil, err
-		}
-
-		decrypted, _ := utils.DecryptAES256(encrypted, key)
-		msg.Content = decrypted
-		msg.ChatID = groupID
-		msg.SentAt = sentAt.Format("2006-01-02 15:04:05")
-		msg.ChatType = "group"
-		messages = append(messages, msg)
-	}
-
-	p.fetchReactionsForMessages(messages)
-	return messages, nil
-}
-
-// SendGroupMessage encrypts and stores a message for a group
-func (p *Postgres) SendGroupMessage(senderID, groupID int, message, sessionID string) error {
-	key, err := getEncryptionKey()
-	if err != nil {
-		return err
+		return 0, err
 	}
 
 	encrypted, err := utils.EncryptAES256(message, key)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	query := `
-		INSERT INTO messages (sender_id, chat_type, chat_id, content, sent_at)
-		VALUES ($1, 'group', $2, $3, NOW())
+		INSERT INTO messages (sender_id, chat_type, chat_id, content, sent_at, parent_id)
+		VALUES ($1, 'group', $2, $3, NOW(), $4)
+		RETURNING id, sent_at
 	`
-	_, err = p.DbConn.Exec(query, senderID, groupID, encrypted)
+	var messageID int
+	var sentAt time.Time
+	err = p.DbConn.QueryRow(query, senderID, groupID, encrypted, nullableID(parentID)).Scan(&messageID, &sentAt)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if err := indexMessage(p.DbConn, messageID, message, key); err != nil {
+		slog.Error("Failed to index message", "id", messageID, "error", err)
 	}
 
 	// Get sender name for Redis
@@ -506,18 +552,24 @@ func (p *Postgres) SendGroupMessage(senderID, groupID int, message, sessionID st
 	p.DbConn.QueryRow("SELECT username FROM users WHERE id = $1", senderID).Scan(&senderName)
 
 	// Publish to Redis
-	// Format: <sessionID>|<senderName>|<timestamp>|<message>
-	payload := fmt.Sprintf("%s|%s|%s|%s", sessionID, senderName, time.Now().Format("2006-01-02 15:04:05"), message)
-	channel := fmt.Sprintf("group:%d", groupID)
-	err = redis.NewRedis(nil).Client.Publish(context.Background(), channel, payload).Err()
-	if err != nil {
-		return err
+	event := factory.ChatEvent{
+		Type:      "MSG",
+		SessionID: sessionID,
+		Sender:    senderName,
+		MessageID: messageID,
+		SentAt:    sentAt.Format("2006-01-02 15:04:05"),
+		Content:   message,
+		ParentID:  parentID,
+	}
+	if err := publishChatEvent(fmt.Sprintf("group:%d", groupID), event); err != nil {
+		return messageID, err
 	}
 
-	// Notify other members
+	// Notify other members; mentioned members get a MENTION instead
 	var groupName string
 	p.DbConn.QueryRow("SELECT name FROM group_chats WHERE id = $1", groupID).Scan(&groupName)
 
+	mentions := msgpkg.ParseMentions(message)
 	rows, err := p.DbConn.Query(`
 		SELECT u.username FROM users u
 		JOIN group_members gm ON u.id = gm.user_id
@@ -528,7 +580,11 @@ func (p *Postgres) SendGroupMessage(senderID, groupID int, message, sessionID st
 		for rows.Next() {
 			var memberName string
 			if err := rows.Scan(&memberName); err == nil {
-				notif := fmt.Sprintf("GROUP_MSG %s|%s", senderName, groupName)
+				frame := protocol.NewFrame("NOTIFY", "GROUP_MSG").With(senderName, groupName)
+				if mentions[strings.ToLower(memberName)] {
+					frame = protocol.NewFrame("NOTIFY", "MENTION").With(senderName, groupName, msgpkg.Preview(message, 60))
+				}
+				notif := protocol.Encode(protocol.V2, frame)
 				// Use a different channel prefix for notifications
 				notifChan := "notify:" + strings.ToLower(memberName)
 				redis.NewRedis(nil).Client.Publish(context.Background(), notifChan, notif)
@@ -536,7 +592,7 @@ func (p *Postgres) SendGroupMessage(senderID, groupID int, message, sessionID st
 		}
 	}
 
-	return nil
+	return messageID, nil
 }
 
 // GetGroupChatID returns the ID of a group chat by name
@@ -604,7 +660,8 @@ func (p *Postgres) AddGroupMember(userID, groupID int) error {
 }
 
 func (p *Postgres) RemoveGroupMember(userID, groupID int) error {
-	return p.LeaveGroupChat(userID, groupID)
+	_, err := p.LeaveGroupChat(userID, groupID)
+	return err
 }
 
 func (p *Postgres) AddReaction(messageID, userID int, emoji string) error {
@@ -619,11 +676,38 @@ func (p *Postgres) AddReaction(messageID, userID int, emoji string) error {
 
 func (p *Postgres) GetLastMessageID(chatType string, chatID int) (int, error) {
 	var id int
-	query := `SELECT id FROM messages WHERE chat_type = $1 AND chat_id = $2 ORDER BY sent_at DESC LIMIT 1`
+	query := `
+		SELECT id FROM messages
+		WHERE chat_type = $1 AND chat_id = $2 AND deleted_at IS NULL
+		ORDER BY sent_at DESC, id DESC LIMIT 1
+	`
 	err := p.DbConn.QueryRow(query, chatType, chatID).Scan(&id)
 	return id, err
 }
 
+// GetMessageByID retrieves and decrypts a single message
+func (p *Postgres) GetMessageByID(messageID int) (factory.Message, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return factory.Message{}, err
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.id = $1
+	`
+	msg, err := scanMessage(p.DbConn.QueryRow(query, messageID), key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return factory.Message{}, fmt.Errorf("message not found")
+		}
+		return factory.Message{}, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	return msg, nil
+}
+
 func (p *Postgres) fetchReactionsForMessages(messages []factory.Message) {
 	if len(messages) == 0 {
 		return
@@ -660,3 +744,284 @@ func (p *Postgres) fetchReactionsForMessages(messages []factory.Message) {
 		}
 	}
 }
+
+// EditMessage replaces the content of a message sent by editorID. The prior
+// ciphertext is kept in message_edits so revisions can be reviewed later.
+func (p *Postgres) EditMessage(messageID, editorID int, newContent string) (factory.Message, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return factory.Message{}, err
+	}
+	encrypted, err := utils.EncryptAES256(newContent, key)
+	if err != nil {
+		return factory.Message{}, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return factory.Message{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent edits keep a linear revision history
+	var senderID int
+	var oldContent string
+	var deletedAt sql.NullTime
+	err = tx.QueryRow(`SELECT sender_id, content, deleted_at FROM messages WHERE id = $1 FOR UPDATE`, messageID).
+		Scan(&senderID, &oldContent, &deletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return factory.Message{}, fmt.Errorf("message not found")
+		}
+		return factory.Message{}, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	if deletedAt.Valid {
+		return factory.Message{}, fmt.Errorf("message deleted")
+	}
+	if senderID != editorID {
+		return factory.Message{}, fmt.Errorf("not the sender")
+	}
+
+	if _, err := tx.Exec(`INSERT INTO message_edits (message_id, content) VALUES ($1, $2)`, messageID, oldContent); err != nil {
+		return factory.Message{}, fmt.Errorf("failed to store revision: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE messages SET content = $1, edited_at = NOW() WHERE id = $2`, encrypted, messageID); err != nil {
+		return factory.Message{}, fmt.Errorf("failed to update message: %w", err)
+	}
+	if err := indexMessage(tx, messageID, newContent, key); err != nil {
+		return factory.Message{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return factory.Message{}, fmt.Errorf("failed to commit edit: %w", err)
+	}
+
+	return p.GetMessageByID(messageID)
+}
+
+// GetMessageEdits returns the decrypted prior revisions of a message, oldest first
+func (p *Postgres) GetMessageEdits(messageID int) ([]factory.MessageEdit, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT content, edited_at
+		FROM message_edits
+		WHERE message_id = $1
+		ORDER BY edited_at ASC, id ASC
+	`
+	rows, err := p.DbConn.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []factory.MessageEdit
+	for rows.Next() {
+		var encrypted string
+		var editedAt time.Time
+		if err := rows.Scan(&encrypted, &editedAt); err != nil {
+			return nil, fmt.Errorf("row scan failed: %w", err)
+		}
+		content, err := utils.DecryptAES256(encrypted, key)
+		if err != nil {
+			content = "[decryption failed]"
+		}
+		edits = append(edits, factory.MessageEdit{
+			MessageID: messageID,
+			Content:   content,
+			EditedAt:  editedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return edits, nil
+}
+
+// DeleteMessage turns a message into a tombstone: the row is kept so history
+// ordering stays intact, but its ciphertext, earlier revisions and reactions
+// are removed
+func (p *Postgres) DeleteMessage(messageID, deletedBy int) error {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE messages SET content = '', deleted_at = NOW(), deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL
+	`, messageID, deletedBy)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("message not found")
+	}
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM message_edits WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM message_tokens WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("failed to delete search tokens: %w", err)
+	}
+	return tx.Commit()
+}
+
+// PurgeUserMessages tombstones every message the user sent, as DeleteMessage
+// does for one. The purged messages come back with ID, ChatType and ChatID
+// set so their rooms can be told.
+func (p *Postgres) PurgeUserMessages(userID, purgedBy int) ([]factory.Message, error) {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE messages SET content = '', deleted_at = NOW(), deleted_by = $2
+		WHERE sender_id = $1 AND deleted_at IS NULL
+		RETURNING id, chat_type, chat_id
+	`, userID, purgedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge messages: %w", err)
+	}
+	var purged []factory.Message
+	var ids []int64
+	for rows.Next() {
+		var m factory.Message
+		if err := rows.Scan(&m.ID, &m.ChatType, &m.ChatID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan purged message: %w", err)
+		}
+		purged = append(purged, m)
+		ids = append(ids, int64(m.ID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to purge messages: %w", err)
+	}
+
+	for _, q := range []string{
+		`DELETE FROM reactions WHERE message_id = ANY($1)`,
+		`DELETE FROM message_edits WHERE message_id = ANY($1)`,
+		`DELETE FROM message_tokens WHERE message_id = ANY($1)`,
+	} {
+		if _, err := tx.Exec(q, pq.Array(ids)); err != nil {
+			return nil, fmt.Errorf("failed to purge messages: %w", err)
+		}
+	}
+	return purged, tx.Commit()
+}
+
+// GetThreadMessages returns the whole thread a message belongs to: its root
+// and every reply below it, oldest first.
+func (p *Postgres) GetThreadMessages(messageID int) ([]factory.Message, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk up to the root, then collect every descendant of it
+	query := `
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM messages WHERE id = $1
+			UNION ALL
+			SELECT p.id, p.parent_id FROM messages p JOIN up ON p.id = up.parent_id
+		), thread AS (
+			SELECT id FROM up WHERE parent_id IS NULL
+			UNION ALL
+			SELECT c.id FROM messages c JOIN thread t ON c.parent_id = t.id
+		)
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.id IN (SELECT id FROM thread)
+		ORDER BY m.sent_at ASC, m.id ASC
+	`
+	rows, err := p.DbConn.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch thread: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []factory.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan thread message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	p.fetchReactionsForMessages(messages)
+	return messages, nil
+}
+
+// MarkMessagesRead moves the user's read pointer for the chat forward to
+// upToID. Only messages past the previous pointer are looked at; in
+// personal chats they also get userID added to read_by, while groups rely
+// on chat_reads alone. Own messages are skipped. It returns the highest
+// newly read message ID, or 0 if nothing changed.
+func (p *Postgres) MarkMessagesRead(chatType string, chatID, userID, upToID int) (int, error) {
+	tx, err := p.DbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var prevID int
+	err = tx.QueryRow(`
+		SELECT last_read_id FROM chat_reads
+		WHERE user_id = $1 AND chat_type = $2 AND chat_id = $3
+		FOR UPDATE
+	`, userID, chatType, chatID).Scan(&prevID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to read read pointer: %w", err)
+	}
+	if upToID <= prevID {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO chat_reads (user_id, chat_type, chat_id, last_read_id, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (user_id, chat_type, chat_id) DO UPDATE
+		SET last_read_id = GREATEST(chat_reads.last_read_id, EXCLUDED.last_read_id),
+		    updated_at = NOW()
+	`, userID, chatType, chatID, upToID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update read pointer: %w", err)
+	}
+
+	query := `
+		SELECT COALESCE(MAX(id), 0) FROM messages
+		WHERE chat_type = $1 AND chat_id = $2 AND id > $4 AND id <= $5
+		  AND sender_id <> $3 AND deleted_at IS NULL
+	`
+	if chatType == "personal" {
+		query = `
+			WITH marked AS (
+				UPDATE messages
+				SET read_by = array_append(COALESCE(read_by, '{}'), $3)
+				WHERE chat_type = $1 AND chat_id = $2 AND id > $4 AND id <= $5
+				  AND sender_id <> $3 AND deleted_at IS NULL
+				  AND NOT ($3 = ANY(COALESCE(read_by, '{}')))
+				RETURNING id
+			)
+			SELECT COALESCE(MAX(id), 0) FROM marked
+		`
+	}
+	var lastID int
+	if err := tx.QueryRow(query, chatType, chatID, userID, prevID, upToID).Scan(&lastID); err != nil {
+		return 0, fmt.Errorf("failed to mark messages read: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to mark messages read: %w", err)
+	}
+	return lastID, nil
+}
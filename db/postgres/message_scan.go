@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"database/sql"
+	"termchat/factory"
+	"termchat/utils"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// messageColumns is the SELECT list shared by every query that returns full
+// messages. The query must alias messages as m and users (the sender) as u.
+// Readers are resolved to usernames here so callers never see raw user IDs:
+// personal chats use read_by, groups derive them from chat_reads pointers.
+const messageColumns = `m.id, m.sender_id, u.username, m.chat_type, m.chat_id, m.content, m.sent_at, m.edited_at, m.deleted_at, m.parent_id,
+	CASE WHEN m.chat_type = 'personal'
+		THEN ARRAY(SELECT ru.username FROM users ru WHERE ru.id = ANY(m.read_by) ORDER BY ru.username)
+		ELSE ARRAY(SELECT ru.username FROM chat_reads cr JOIN users ru ON ru.id = cr.user_id
+			WHERE cr.chat_type = m.chat_type AND cr.chat_id = m.chat_id
+			  AND cr.last_read_id >= m.id AND cr.user_id <> m.sender_id
+			ORDER BY ru.username)
+	END`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage reads a row selected with messageColumns and decrypts it.
+// Deleted messages come back as tombstones with empty content.
+func scanMessage(row rowScanner, key []byte) (factory.Message, error) {
+	var msg factory.Message
+	var encrypted string
+	var sentAt time.Time
+	var editedAt, deletedAt sql.NullTime
+	var parentID sql.NullInt64
+	var readBy []string
+
+	err := row.Scan(
+		&msg.ID, &msg.SenderID, &msg.SenderName, &msg.ChatType, &msg.ChatID,
+		&encrypted, &sentAt, &editedAt, &deletedAt, &parentID, pq.Array(&readBy),
+	)
+	if err != nil {
+		return factory.Message{}, err
+	}
+
+	msg.SentAt = sentAt.Format("2006-01-02 15:04:05")
+	if parentID.Valid {
+		msg.ParentID = int(parentID.Int64)
+	}
+	msg.ReadBy = readBy
+	if editedAt.Valid {
+		msg.EditedAt = editedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	if deletedAt.Valid {
+		msg.DeletedAt = deletedAt.Time.Format("2006-01-02 15:04:05")
+		return msg, nil
+	}
+
+	decrypted, err := utils.DecryptAES256(encrypted, key)
+	if err != nil {
+		msg.Content = "[decryption failed]"
+	} else {
+		msg.Content = decrypted
+	}
+	return msg, nil
+}
+
+// nullableID maps 0 to NULL for optional foreign keys such as parent_id
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
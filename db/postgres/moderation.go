@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"termchat/factory"
+	"time"
+)
+
+// SetServerAdmin grants or revokes the server admin flag
+func (p *Postgres) SetServerAdmin(email string, admin bool) error {
+	res, err := p.DbConn.Exec(`UPDATE users SET is_admin = $1 WHERE email = $2`, admin, email)
+	if err != nil {
+		return fmt.Errorf("failed to update admin flag: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// IsServerAdmin reports whether the user is a server admin
+func (p *Postgres) IsServerAdmin(userID int) (bool, error) {
+	var admin bool
+	err := p.DbConn.QueryRow(`SELECT is_admin FROM users WHERE id = $1`, userID).Scan(&admin)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to check admin flag: %w", err)
+	}
+	return admin, nil
+}
+
+// BanUser bans a user until the given time, or for good when until is
+// nil. An existing ban is replaced.
+func (p *Postgres) BanUser(userID, bannedBy int, reason string, until *time.Time) error {
+	_, err := p.DbConn.Exec(`
+		INSERT INTO user_bans (user_id, banned_by, reason, banned_until)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET banned_by = EXCLUDED.banned_by, reason = EXCLUDED.reason,
+			banned_until = EXCLUDED.banned_until, created_at = NOW()
+	`, userID, bannedBy, reason, until)
+	if err != nil {
+		return fmt.Errorf("failed to ban user: %w", err)
+	}
+	return nil
+}
+
+// UnbanUser lifts a ban
+func (p *Postgres) UnbanUser(userID int) error {
+	res, err := p.DbConn.Exec(`DELETE FROM user_bans WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unban user: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("user is not banned")
+	}
+	return nil
+}
+
+// GetActiveBan returns the user's ban, or nil if there is none or it has
+// run out.
+func (p *Postgres) GetActiveBan(userID int) (*factory.Ban, error) {
+	var ban factory.Ban
+	var bannedBy sql.NullString
+	var until sql.NullTime
+	err := p.DbConn.QueryRow(`
+		SELECT b.user_id, u.username, b.reason, b.banned_until
+		FROM user_bans b
+		LEFT JOIN users u ON u.id = b.banned_by
+		WHERE b.user_id = $1 AND (b.banned_until IS NULL OR b.banned_until > NOW())
+	`, userID).Scan(&ban.UserID, &bannedBy, &ban.Reason, &until)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ban: %w", err)
+	}
+	ban.BannedBy = bannedBy.String
+	if until.Valid {
+		ban.Until = until.Time.Format(time.RFC3339)
+	}
+	return &ban, nil
+}
@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"termchat/factory"
+	"termchat/utils"
+
+	"github.com/lib/pq"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// indexMessage replaces the blinded search tokens of a message
+func indexMessage(ex execer, messageID int, content string, key []byte) error {
+	if _, err := ex.Exec(`DELETE FROM message_tokens WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("failed to clear search tokens: %w", err)
+	}
+	tokens := utils.SearchTokens(content)
+	if len(tokens) == 0 {
+		return nil
+	}
+	_, err := ex.Exec(`
+		INSERT INTO message_tokens (token, message_id)
+		SELECT unnest($1::text[]), $2
+		ON CONFLICT DO NOTHING
+	`, pq.Array(utils.BlindTokens(tokens, key)), messageID)
+	if err != nil {
+		return fmt.Errorf("failed to store search tokens: %w", err)
+	}
+	return nil
+}
+
+// FindMessages returns the newest messages containing every word of query,
+// limited to conversations userID belongs to and the global room. chatType/chatID narrow the
+// search to one conversation when chatType is not empty.
+func (p *Postgres) FindMessages(userID int, query, chatType string, chatID, limit int) ([]factory.MessageHit, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	tokens := utils.SearchTokens(query)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("query too short")
+	}
+
+	// Step 1: matching message IDs plus a label of the conversation
+	rows, err := p.DbConn.Query(`
+		SELECT m.id,
+			CASE WHEN m.chat_type = 'group' THEN g.name ELSE '@' || pu.username END
+		FROM messages m
+		LEFT JOIN group_chats g
+			ON m.chat_type = 'group' AND g.id = m.chat_id
+		LEFT JOIN personal_chats pc
+			ON m.chat_type = 'personal' AND pc.id = m.chat_id
+		LEFT JOIN users pu
+			ON pu.id = CASE WHEN pc.user1_id = $3 THEN pc.user2_id ELSE pc.user1_id END
+		WHERE m.deleted_at IS NULL
+		  AND m.id IN (
+			SELECT message_id FROM message_tokens
+			WHERE token = ANY($1)
+			GROUP BY message_id
+			HAVING COUNT(*) = $2
+		  )
+		  AND (
+			(m.chat_type = 'personal' AND (pc.user1_id = $3 OR pc.user2_id = $3))
+			OR (m.chat_type = 'group' AND (g.is_global OR EXISTS (
+				SELECT 1 FROM group_members gm WHERE gm.group_id = m.chat_id AND gm.user_id = $3
+			)))
+		  )
+		  AND ($4 = '' OR (m.chat_type = $4 AND m.chat_id = $5))
+		ORDER BY m.id DESC
+		LIMIT $6
+	`, pq.Array(utils.BlindTokens(tokens, key)), len(tokens), userID, chatType, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	chats := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var chat sql.NullString
+		if err := rows.Scan(&id, &chat); err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		ids = append(ids, id)
+		chats[id] = chat.String
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Step 2: load and decrypt the hits
+	msgRows, err := p.DbConn.Query(`
+		SELECT `+messageColumns+`
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.id = ANY($1)
+		ORDER BY m.id DESC
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch search hits: %w", err)
+	}
+	defer msgRows.Close()
+
+	var hits []factory.MessageHit
+	for msgRows.Next() {
+		msg, err := scanMessage(msgRows, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		hits = append(hits, factory.MessageHit{Message: msg, Chat: chats[msg.ID]})
+	}
+	return hits, nil
+}
+
+// ReindexMessages rebuilds the search tokens of every live message, e.g.
+// for history written before the index existed. It returns how many
+// messages were indexed.
+func (p *Postgres) ReindexMessages() (int, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := p.DbConn.Query(`SELECT id, content FROM messages WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id      int
+		content string
+	}
+	var all []pending
+	for rows.Next() {
+		var m pending
+		if err := rows.Scan(&m.id, &m.content); err != nil {
+			return 0, fmt.Errorf("failed to scan message: %w", err)
+		}
+		all = append(all, m)
+	}
+
+	count := 0
+	for _, m := range all {
+		plain, err := utils.DecryptAES256(m.content, key)
+		if err != nil {
+			continue
+		}
+		if err := indexMessage(p.DbConn, m.id, plain, key); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
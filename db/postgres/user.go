@@ -52,13 +52,16 @@ func (p *Postgres) Login(data factory.User) (factory.User, error) {
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return factory.User{}, fmt.Errorf("user not found")
+			// Same bcrypt cost as a real account, so timing does not leak
+			// which emails are registered
+			users.BurnPasswordCheck(data.Password)
+			return factory.User{}, users.ErrInvalidCredentials
 		}
 		return factory.User{}, fmt.Errorf("login query failed: %w", err)
 	}
 
 	if !users.VerifyPassword(hashedPassword, data.Password) {
-		return factory.User{}, fmt.Errorf("invalid password")
+		return factory.User{}, users.ErrInvalidCredentials
 	}
 
 	user.Created = createdAt.Format(time.RFC3339)
@@ -116,18 +119,17 @@ func (p *Postgres) GetAllUsers() ([]factory.User, error) {
 	return usersList, nil
 }
 
-// DeleteUser deletes a user by email
+// DeleteUser deletes a user by email, purging their messages (see DeleteAccount)
 func (p *Postgres) DeleteUser(email string) error {
-	query := `DELETE FROM users WHERE email = $1`
-	res, err := p.DbConn.Exec(query, email)
+	var id int
+	err := p.DbConn.QueryRow(`SELECT id FROM users WHERE email = $1`, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user found with email %s", email)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		return fmt.Errorf("no user found with email %s", email)
-	}
-	return nil
+	return p.DeleteAccount(id, true)
 }
 
 // GetUserByUsername retrieves a user by username
@@ -135,12 +137,14 @@ func (p *Postgres) GetUserByUsername(username string) (factory.User, error) {
 	var user factory.User
 	var createdAt time.Time
 
+	var lastLogin sql.NullTime
+
 	query := `
-		SELECT id, email, username, created_at
+		SELECT id, email, username, created_at, last_login
 		FROM users WHERE username = $1
 	`
 	err := p.DbConn.QueryRow(query, username).Scan(
-		&user.ID, &user.Email, &user.Name, &createdAt,
+		&user.ID, &user.Email, &user.Name, &createdAt, &lastLogin,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -150,13 +154,16 @@ func (p *Postgres) GetUserByUsername(username string) (factory.User, error) {
 	}
 
 	user.Created = createdAt.Format(time.RFC3339)
+	if lastLogin.Valid {
+		user.LastLogin = lastLogin.Time.Format("2006-01-02 15:04:05")
+	}
 	return user, nil
 }
 
 // search username it will give auto suggestion
 func (p *Postgres) SearchUsersByName(name string) ([]factory.User, error) {
 	query := `
-		SELECT id, email, username, created_at
+		SELECT id, email, username, created_at, last_login
 		FROM users WHERE username ILIKE $1
 	`
 	rows, err := p.DbConn.Query(query, name+"%")
@@ -169,14 +176,116 @@ func (p *Postgres) SearchUsersByName(name string) ([]factory.User, error) {
 	for rows.Next() {
 		var user factory.User
 		var createdAt time.Time
+		var lastLogin sql.NullTime
 
-		err := rows.Scan(&user.ID, &user.Email, &user.Name, &createdAt)
+		err := rows.Scan(&user.ID, &user.Email, &user.Name, &createdAt, &lastLogin)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 
 		user.Created = createdAt.Format(time.RFC3339)
+		if lastLogin.Valid {
+			user.LastLogin = lastLogin.Time.Format("2006-01-02 15:04:05")
+		}
 		usersList = append(usersList, user)
 	}
 	return usersList, nil
 }
+
+// UpdateLastLogin stamps users.last_login with the current time
+func (p *Postgres) UpdateLastLogin(userID int) error {
+	_, err := p.DbConn.Exec("UPDATE users SET last_login = NOW() WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+	return nil
+}
+
+// AddSSHKey registers a public key for SSH logins
+func (p *Postgres) AddSSHKey(userID int, fingerprint, publicKey string) error {
+	_, err := p.DbConn.Exec(`
+		INSERT INTO user_ssh_keys (user_id, fingerprint, public_key) VALUES ($1, $2, $3)
+	`, userID, fingerprint, publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to add ssh key: %w", err)
+	}
+	return nil
+}
+
+// GetSSHKeys lists the public keys a user registered, oldest first
+func (p *Postgres) GetSSHKeys(userID int) ([]factory.SSHKey, error) {
+	rows, err := p.DbConn.Query(`
+		SELECT fingerprint, public_key, created_at
+		FROM user_ssh_keys WHERE user_id = $1 ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssh keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []factory.SSHKey
+	for rows.Next() {
+		var key factory.SSHKey
+		var createdAt time.Time
+		if err := rows.Scan(&key.Fingerprint, &key.PublicKey, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ssh key: %w", err)
+		}
+		key.Created = createdAt.Format(time.RFC3339)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DeleteSSHKey removes one of the user's public keys
+func (p *Postgres) DeleteSSHKey(userID int, fingerprint string) error {
+	res, err := p.DbConn.Exec(`
+		DELETE FROM user_ssh_keys WHERE user_id = $1 AND fingerprint = $2
+	`, userID, fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to delete ssh key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("ssh key not found")
+	}
+	return nil
+}
+
+// HasSSHKey reports whether the key with this fingerprint belongs to username
+func (p *Postgres) HasSSHKey(username, fingerprint string) (bool, error) {
+	var exists bool
+	err := p.DbConn.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_ssh_keys k
+			JOIN users u ON u.id = k.user_id
+			WHERE u.username = $1 AND k.fingerprint = $2
+		)
+	`, username, fingerprint).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check ssh key: %w", err)
+	}
+	return exists, nil
+}
+
+// RecordLockout stores a lockout event for later review
+func (p *Postgres) RecordLockout(scope, subject, ip string, failures int, until time.Time) error {
+	_, err := p.DbConn.Exec(`
+		INSERT INTO auth_lockouts (scope, subject, ip, failures, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+	`, scope, subject, ip, failures, until)
+	if err != nil {
+		return fmt.Errorf("failed to record lockout: %w", err)
+	}
+	return nil
+}
+
+// UpdatePassword replaces the user's password hash
+func (p *Postgres) UpdatePassword(email, hashedPassword string) error {
+	res, err := p.DbConn.Exec("UPDATE users SET password_hash = $1 WHERE email = $2", hashedPassword, email)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
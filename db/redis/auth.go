@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+func authFailKey(key string) string { return "authfail:" + key }
+
+func authBlockKey(key string) string { return "authblock:" + key }
+
+// RecordAuthFailure counts a failed login for key (an account or an IP)
+// and returns the count within window.
+func (r *Redis) RecordAuthFailure(key string, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	pipe := r.Client.TxPipeline()
+	incr := pipe.Incr(ctx, authFailKey(key))
+	pipe.Expire(ctx, authFailKey(key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// ResetAuthFailures forgets the failed logins of key
+func (r *Redis) ResetAuthFailures(key string) error {
+	return r.Client.Del(context.Background(), authFailKey(key)).Err()
+}
+
+// BlockAuth refuses logins for key during d, unless a longer block is
+// already in place
+func (r *Redis) BlockAuth(key string, d time.Duration) error {
+	ctx := context.Background()
+	if ttl, err := r.Client.PTTL(ctx, authBlockKey(key)).Result(); err == nil && ttl > d {
+		return nil
+	}
+	return r.Client.Set(ctx, authBlockKey(key), "1", d).Err()
+}
+
+// AuthBlockedFor returns how long logins for key stay refused, 0 if they
+// are allowed
+func (r *Redis) AuthBlockedFor(key string) (time.Duration, error) {
+	ttl, err := r.Client.PTTL(context.Background(), authBlockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"termchat/factory"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func inviteCodeKey(code string) string { return "invitecode:" + code }
+
+func groupCodesKey(groupID int) string { return fmt.Sprintf("invitecodes:%d", groupID) }
+
+// redeemCode uses up one use of the invite code KEYS[1] and returns its
+// group ID, or -1 if the code is unknown or expired. A code with uses -1
+// never runs out. The code's last use also drops it from the group's set.
+var redeemCode = redis.NewScript(`
+local c = redis.call('HMGET', KEYS[1], 'group_id', 'uses')
+if not c[1] then
+	return -1
+end
+local uses = tonumber(c[2])
+if uses == 1 then
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', 'invitecodes:' .. c[1], ARGV[1])
+elseif uses > 1 then
+	redis.call('HINCRBY', KEYS[1], 'uses', -1)
+end
+return tonumber(c[1])
+`)
+
+// CreateInviteCode stores a new invite code for the group that can be
+// redeemed uses times (-1 for no limit) within ttl.
+func (r *Redis) CreateInviteCode(groupID int, createdBy string, uses int, ttl time.Duration) (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	code := hex.EncodeToString(b)
+
+	ctx := context.Background()
+	pipe := r.Client.TxPipeline()
+	pipe.HSet(ctx, inviteCodeKey(code), "group_id", groupID, "created_by", createdBy, "uses", uses)
+	pipe.Expire(ctx, inviteCodeKey(code), ttl)
+	pipe.SAdd(ctx, groupCodesKey(groupID), code)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to store invite code: %w", err)
+	}
+	return code, nil
+}
+
+// InviteCodeGroup returns the group an invite code is for without using
+// it up, 0 if the code is unknown or expired.
+func (r *Redis) InviteCodeGroup(code string) (int, error) {
+	id, err := r.Client.HGet(context.Background(), inviteCodeKey(code), "group_id").Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return id, err
+}
+
+// RedeemInviteCode uses up one use of code and returns its group, 0 if
+// the code is unknown or expired.
+func (r *Redis) RedeemInviteCode(code string) (int, error) {
+	id, err := redeemCode.Run(context.Background(), r.Client, []string{inviteCodeKey(code)}, code).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to redeem invite code: %w", err)
+	}
+	if id < 0 {
+		return 0, nil
+	}
+	return id, nil
+}
+
+// ListInviteCodes returns the group's outstanding invite codes, forgetting
+// the ones that have expired.
+func (r *Redis) ListInviteCodes(groupID int) ([]factory.InviteCode, error) {
+	ctx := context.Background()
+	codes, err := r.Client.SMembers(ctx, groupCodesKey(groupID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var list []factory.InviteCode
+	for _, code := range codes {
+		fields, err := r.Client.HGetAll(ctx, inviteCodeKey(code)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			r.Client.SRem(ctx, groupCodesKey(groupID), code)
+			continue
+		}
+		ttl, err := r.Client.PTTL(ctx, inviteCodeKey(code)).Result()
+		if err != nil {
+			return nil, err
+		}
+		uses, _ := strconv.Atoi(fields["uses"])
+		list = append(list, factory.InviteCode{
+			Code:      code,
+			GroupID:   groupID,
+			CreatedBy: fields["created_by"],
+			UsesLeft:  uses,
+			ExpiresAt: time.Now().Add(ttl).Format(time.RFC3339),
+		})
+	}
+	return list, nil
+}
+
+// RevokeInviteCode deletes one of the group's invite codes and reports
+// whether it existed.
+func (r *Redis) RevokeInviteCode(groupID int, code string) (bool, error) {
+	ctx := context.Background()
+	removed, err := r.Client.SRem(ctx, groupCodesKey(groupID), code).Result()
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	return true, r.Client.Del(ctx, inviteCodeKey(code)).Err()
+}
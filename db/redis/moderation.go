@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+func roomMuteKey(room, name string) string { return "roommute:" + room + ":" + name }
+
+// MuteInRoom stops name from sending in room (a Redis channel such as
+// group:<id>) for d, or until UnmuteInRoom when d is 0.
+func (r *Redis) MuteInRoom(room, name string, d time.Duration) error {
+	return r.Client.Set(context.Background(), roomMuteKey(room, name), "1", d).Err()
+}
+
+// UnmuteInRoom lifts a room mute and reports whether there was one
+func (r *Redis) UnmuteInRoom(room, name string) (bool, error) {
+	n, err := r.Client.Del(context.Background(), roomMuteKey(room, name)).Result()
+	return n > 0, err
+}
+
+// MutedInRoom reports whether name is muted in room and for how long; the
+// duration is 0 for a mute without expiry.
+func (r *Redis) MutedInRoom(room, name string) (bool, time.Duration, error) {
+	ttl, err := r.Client.PTTL(context.Background(), roomMuteKey(room, name)).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	// go-redis passes -2 (no key) and -1 (no expiry) through unscaled
+	switch ttl {
+	case -2:
+		return false, 0, nil
+	case -1:
+		return true, 0, nil
+	}
+	return true, ttl, nil
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Presence states. A user without a live session is offline.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// Presence is tracked per connection in the hash presences:<username>: each
+// field is a session ID holding "<state>|<expires unix>". The user is online
+// if any session is, away if every live session is away, and offline once
+// the last one is cleared or stops sending heartbeats.
+const presencePrefix = "presences:"
+
+func presenceKey(username string) string {
+	return presencePrefix + username
+}
+
+// SetPresence records the state of one of the user's sessions; it expires
+// after ttl unless the connection refreshes it with another heartbeat.
+func (r *Redis) SetPresence(username, sessionID, status string, ttl time.Duration) error {
+	ctx := context.Background()
+	key := presenceKey(username)
+	value := fmt.Sprintf("%s|%d", status, time.Now().Add(ttl).Unix())
+	pipe := r.Client.TxPipeline()
+	pipe.HSet(ctx, key, sessionID, value)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ClearPresence drops one session right away; the user stays present while
+// any other session is live.
+func (r *Redis) ClearPresence(username, sessionID string) error {
+	return r.Client.HDel(context.Background(), presenceKey(username), sessionID).Err()
+}
+
+// ClearAllPresence marks the user offline on every session
+func (r *Redis) ClearAllPresence(username string) error {
+	return r.Client.Del(context.Background(), presenceKey(username)).Err()
+}
+
+// presenceState folds the sessions of one user into a single state and
+// returns the sessions that have expired without being cleared.
+func presenceState(sessions map[string]string, now time.Time) (string, []string) {
+	state := PresenceOffline
+	var stale []string
+	for id, value := range sessions {
+		status, expires, ok := strings.Cut(value, "|")
+		until, err := strconv.ParseInt(expires, 10, 64)
+		if !ok || err != nil || now.Unix() >= until {
+			stale = append(stale, id)
+			continue
+		}
+		switch {
+		case status == PresenceOnline:
+			state = PresenceOnline
+		case status == PresenceAway && state == PresenceOffline:
+			state = PresenceAway
+		}
+	}
+	return state, stale
+}
+
+// presenceOf reads the sessions of each user in one round trip and prunes
+// the ones left behind by connections that died without clearing them.
+func (r *Redis) presenceOf(usernames []string) (map[string]string, error) {
+	ctx := context.Background()
+	pipe := r.Client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(usernames))
+	for i, name := range usernames {
+		cmds[i] = pipe.HGetAll(ctx, presenceKey(name))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make(map[string]string, len(usernames))
+	for i, name := range usernames {
+		state, stale := presenceState(cmds[i].Val(), now)
+		if len(stale) > 0 {
+			_ = r.Client.HDel(ctx, presenceKey(name), stale...).Err()
+		}
+		result[name] = state
+	}
+	return result, nil
+}
+
+// GetPresence returns the state of each user, PresenceOffline for unknown ones
+func (r *Redis) GetPresence(usernames ...string) (map[string]string, error) {
+	if len(usernames) == 0 {
+		return make(map[string]string), nil
+	}
+	return r.presenceOf(usernames)
+}
+
+// OnlineUsers returns every user with a live session and their state
+func (r *Redis) OnlineUsers() (map[string]string, error) {
+	ctx := context.Background()
+	var names []string
+	iter := r.Client.Scan(ctx, 0, presencePrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		names = append(names, strings.TrimPrefix(iter.Val(), presencePrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	online := make(map[string]string, len(names))
+	if len(names) == 0 {
+		return online, nil
+	}
+	states, err := r.presenceOf(names)
+	if err != nil {
+		return nil, err
+	}
+	for name, state := range states {
+		if state != PresenceOffline {
+			online[name] = state
+		}
+	}
+	return online, nil
+}
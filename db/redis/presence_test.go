@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestPresenceStateTwoSessions(t *testing.T) {
+	now := time.Now()
+	live := fmt.Sprint(now.Add(time.Minute).Unix())
+	gone := fmt.Sprint(now.Add(-time.Second).Unix())
+
+	tests := []struct {
+		name      string
+		sessions  map[string]string
+		want      string
+		wantStale int
+	}{
+		{"no sessions", nil, PresenceOffline, 0},
+		{"online and away", map[string]string{"a": "online|" + live, "b": "away|" + live}, PresenceOnline, 0},
+		{"both away", map[string]string{"a": "away|" + live, "b": "away|" + live}, PresenceAway, 0},
+		{"one expired", map[string]string{"a": "online|" + gone, "b": "away|" + live}, PresenceAway, 1},
+		{"both expired", map[string]string{"a": "online|" + gone, "b": "online|" + gone}, PresenceOffline, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stale := presenceState(tt.sessions, now)
+			if got != tt.want || len(stale) != tt.wantStale {
+				t.Errorf("presenceState() = %q, %d stale; want %q, %d stale", got, len(stale), tt.want, tt.wantStale)
+			}
+		})
+	}
+}
+
+// testRedis connects to $REDIS_URL, skipping the test when it is not set.
+func testRedis(t *testing.T) *Redis {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set")
+	}
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("invalid REDIS_URL: %v", err)
+	}
+	r := &Redis{Client: redis.NewClient(opt)}
+	if err := r.Client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis unavailable: %v", err)
+	}
+	t.Cleanup(func() { r.Client.Close() })
+	return r
+}
+
+func TestPresenceSurvivesOtherSessionEnding(t *testing.T) {
+	r := testRedis(t)
+	user := fmt.Sprintf("presence-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = r.ClearAllPresence(user) })
+
+	if err := r.SetPresence(user, "ssh", PresenceOnline, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetPresence(user, "tui", PresenceAway, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.ClearPresence(user, "ssh"); err != nil {
+		t.Fatal(err)
+	}
+	states, err := r.GetPresence(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states[user] != PresenceAway {
+		t.Fatalf("after first session ended: got %q, want %q", states[user], PresenceAway)
+	}
+
+	if err := r.ClearPresence(user, "tui"); err != nil {
+		t.Fatal(err)
+	}
+	states, err = r.GetPresence(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states[user] != PresenceOffline {
+		t.Fatalf("after last session ended: got %q, want %q", states[user], PresenceOffline)
+	}
+	online, err := r.OnlineUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := online[user]; ok {
+		t.Fatalf("OnlineUsers still lists %s", user)
+	}
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucket refills KEYS[1] at ARGV[1] tokens per second up to ARGV[2]
+// and takes one token. It uses the Redis clock so every server instance
+// agrees on the bucket. Returns {allowed, seconds until a token is free}.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = (1 - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, tostring(wait)}
+`)
+
+// TakeToken takes one token from the bucket named key, refilled at rate per
+// second with room for burst tokens. When the bucket is empty it returns
+// false and how long until the next token.
+func (r *Redis) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	res, err := tokenBucket.Run(context.Background(), r.Client, []string{"ratelimit:" + key}, rate, burst).Slice()
+	if err != nil {
+		return true, 0, fmt.Errorf("rate limit script failed: %w", err)
+	}
+	allowed, _ := res[0].(int64)
+	wait, _ := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	return allowed == 1, time.Duration(wait * float64(time.Second)), nil
+}
+
+func strikeKey(name string) string { return "ratestrikes:" + name }
+
+func muteKey(name string) string { return "ratemute:" + name }
+
+// AddStrike counts a rate limit violation for name and returns the count
+// so far. Strikes are forgotten once window passes without a new one.
+func (r *Redis) AddStrike(name string, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	pipe := r.Client.TxPipeline()
+	incr := pipe.Incr(ctx, strikeKey(name))
+	pipe.Expire(ctx, strikeKey(name), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// AutoMute stops name from sending for d and forgets its strikes
+func (r *Redis) AutoMute(name string, d time.Duration) error {
+	ctx := context.Background()
+	pipe := r.Client.TxPipeline()
+	pipe.Set(ctx, muteKey(name), "1", d)
+	pipe.Del(ctx, strikeKey(name))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// MutedFor returns how long name stays auto-muted, 0 if it is not muted
+func (r *Redis) MutedFor(name string) (time.Duration, error) {
+	ttl, err := r.Client.PTTL(context.Background(), muteKey(name)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
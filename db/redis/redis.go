@@ -2,7 +2,7 @@ package redis
 
 import (
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"log/slog"
@@ -73,68 +73,137 @@ func NewRedis(envType *string) *Redis {
 	return instance
 }
 
-// StoreEmailHash stores a hashed version of the email in Redis
+// emailHashTTL is how long a password reset code stays valid
+const emailHashTTL = 30 * time.Minute
+
+func emailHashKey(hash string) string { return "emailhash:" + hash }
+
+// StoreEmailHash stores a random single-use code for the email in Redis,
+// e.g. for a password reset. The code is random rather than derived from
+// the email, so it cannot be computed by anyone who knows the address.
 func (r *Redis) StoreEmailHash(email string) (string, error) {
-	// Create a SHA256 hash of the email
-	h := sha256.New()
-	h.Write([]byte(email))
-	bs := base64.URLEncoding.EncodeToString(h.Sum(nil))
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	bs := base64.RawURLEncoding.EncodeToString(b)
 
 	// Store the hash and email in Redis
-	return string(bs), r.Client.Set(context.Background(), string(bs), email, 0).Err()
+	return bs, r.Client.Set(context.Background(), emailHashKey(bs), email, emailHashTTL).Err()
 }
 
 // GetEmailFromHash retrieves the email from Redis using the hash, and then deletes the key
 func (r *Redis) GetEmailFromHash(hash string) (string, error) {
 	ctx := context.Background()
-	email, err := r.Client.Get(ctx, hash).Result()
-	if err != nil || len(email) == 0 {
-		return "", err
+	// GET and DEL in one transaction so a code can only be used once
+	pipe := r.Client.TxPipeline()
+	get := pipe.Get(ctx, emailHashKey(hash))
+	pipe.Del(ctx, emailHashKey(hash))
+	if _, err := pipe.Exec(ctx); err != nil || get.Val() == "" {
+		return "", fmt.Errorf("invalid or expired code")
 	}
-	// Now delete the key from Redis
-	err = r.Client.Del(ctx, hash).Err()
-	return email, err
+	return get.Val(), nil
 }
 
-// GenerateToken generates a new token for a session (like a JWT or random string)
+// sessionTTL is how long an unused session token stays valid. Every
+// /resume extends it.
+const sessionTTL = 7 * 24 * time.Hour
+
+func tokenKey(token string) string { return "token:" + token }
+
+func sessionKey(email string) string { return "session:" + email }
+
+// GenerateToken creates a random session token for email and maps it back
+// to the email in Redis
 func (r *Redis) GenerateToken(email string) (string, error) {
-	// Create a SHA256 hash of the email and current timestamp for uniqueness
-	h := sha256.New()
-	h.Write([]byte(email + time.Now().String())) // Include timestamp for uniqueness
-	token := base64.URLEncoding.EncodeToString(h.Sum(nil))
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
 
-	// Store the token in Redis with an expiration of 1 hour
-	if err := r.Client.Set(context.Background(), token, email, time.Hour).Err(); err != nil {
+	if err := r.Client.Set(context.Background(), tokenKey(token), email, sessionTTL).Err(); err != nil {
 		return "", fmt.Errorf("failed to store token in Redis: %w", err)
 	}
 
 	return token, nil
 }
 
-// CheckSession checks if a session (token) exists for the given email
-func (r *Redis) CheckSession(email string) (bool, error) {
-	// Redis key to check for session existence
-	key := "session:" + email
+// CheckSession reports whether token is one of the live sessions of email
+func (r *Redis) CheckSession(email, token string) (bool, error) {
+	key := sessionKey(email)
 	slog.Debug("Checking session for email", "email", email, "key", key)
 
-	exists, err := r.Client.Exists(context.Background(), key).Result()
+	exists, err := r.Client.SIsMember(context.Background(), key, token).Result()
 	if err != nil {
 		slog.Error("Error checking session existence", "error", err)
 		return false, err
 	}
 
 	slog.Debug("Session exists", "exists", exists)
-	return exists == 1, nil
+	return exists, nil
 }
 
-// StoreSession stores a session (token) in Redis
+// StoreSession adds token to the set of live sessions of email
 func (r *Redis) StoreSession(email, token string) error {
-	key := "session:" + email
-	return r.Client.Set(context.Background(), key, token, time.Hour).Err() // Session expires after 1 hour
+	ctx := context.Background()
+	key := sessionKey(email)
+	pipe := r.Client.TxPipeline()
+	pipe.SAdd(ctx, key, token)
+	pipe.Expire(ctx, key, sessionTTL)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// DeleteSession deletes the session (token) from Redis for a given email
-func (r *Redis) DeleteSession(email string) error {
-	key := "session:" + email
-	return r.Client.Del(context.Background(), key).Err()
+// ResumeSession returns the email a live session token belongs to and
+// extends the session's lifetime
+func (r *Redis) ResumeSession(token string) (string, error) {
+	ctx := context.Background()
+	email, err := r.Client.Get(ctx, tokenKey(token)).Result()
+	if err != nil {
+		return "", fmt.Errorf("session expired")
+	}
+	ok, err := r.CheckSession(email, token)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("session expired")
+	}
+
+	pipe := r.Client.TxPipeline()
+	pipe.Expire(ctx, tokenKey(token), sessionTTL)
+	pipe.Expire(ctx, sessionKey(email), sessionTTL)
+	_, err = pipe.Exec(ctx)
+	return email, err
+}
+
+// DeleteOtherSessions ends every session of email except keep, which may
+// be empty to end them all
+func (r *Redis) DeleteOtherSessions(email, keep string) error {
+	ctx := context.Background()
+	tokens, err := r.Client.SMembers(ctx, sessionKey(email)).Result()
+	if err != nil {
+		return err
+	}
+	pipe := r.Client.TxPipeline()
+	for _, token := range tokens {
+		if token == keep {
+			continue
+		}
+		pipe.SRem(ctx, sessionKey(email), token)
+		pipe.Del(ctx, tokenKey(token))
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DeleteSession ends one session (token) of the given email
+func (r *Redis) DeleteSession(email, token string) error {
+	ctx := context.Background()
+	pipe := r.Client.TxPipeline()
+	pipe.SRem(ctx, sessionKey(email), token)
+	pipe.Del(ctx, tokenKey(token))
+	_, err := pipe.Exec(ctx)
+	return err
 }
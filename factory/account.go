@@ -0,0 +1,26 @@
+package factory
+
+// AccountExport is everything /account export hands back to a user
+type AccountExport struct {
+	ExportedAt  string             `json:"exported_at"`
+	Profile     User               `json:"profile"`
+	Messages    []Message          `json:"messages"` // sent by the user, decrypted
+	Reactions   []ExportedReaction `json:"reactions"`
+	Memberships []GroupMembership  `json:"memberships"`
+	Chats       []string           `json:"chats"` // partners of personal chats
+	SSHKeys     []SSHKey           `json:"ssh_keys"`
+}
+
+// ExportedReaction is a reaction the user left on a message
+type ExportedReaction struct {
+	MessageID int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Created   string `json:"created"`
+}
+
+// GroupMembership is one group the user belongs to
+type GroupMembership struct {
+	Group    string `json:"group"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
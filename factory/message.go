@@ -9,17 +9,48 @@ type Message struct {
 	Content      string            `json:"content"` // decrypted text
 	SentAt       string            `json:"sent_at"` // formatted timestamp
 	ChatType     string            `json:"chat_type"`
-	Reactions    map[string]string `json:"reactions"` // username -> emoji
+	Reactions    map[string]string `json:"reactions"`            // username -> emoji
+	EditedAt     string            `json:"edited_at,omitempty"`  // empty if never edited
+	DeletedAt    string            `json:"deleted_at,omitempty"` // set on tombstones, Content is empty
+	ParentID     int               `json:"parent_id,omitempty"`  // message this one replies to, 0 if none
+	ReadBy       []string          `json:"read_by,omitempty"`    // usernames that have seen the message
+}
+
+// MessageEdit is a prior revision of an edited message
+type MessageEdit struct {
+	MessageID int    `json:"message_id"`
+	Content   string `json:"content"` // decrypted text of the revision
+	EditedAt  string `json:"edited_at"`
 }
 
 type GroupChat struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	OwnerID     int    `json:"owner_id"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-	IsGlobal    bool   `json:"is_global"`
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	OwnerID         int    `json:"owner_id"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+	IsGlobal        bool   `json:"is_global"`
+	PinnedMessageID int    `json:"pinned_message_id,omitempty"` // 0 if nothing is pinned
+	Visibility      string `json:"visibility"`                  // public, private or invite_only
+}
+
+// MessageHit is a /find result together with the conversation it is in
+type MessageHit struct {
+	Message
+	Chat string `json:"chat"` // "@partner" or group name
+}
+
+// RoomSummary is one entry of a user's conversation list
+type RoomSummary struct {
+	ChatType   string `json:"chat_type"` // personal or group
+	ChatID     int    `json:"chat_id"`
+	Name       string `json:"name"` // partner username or group name
+	Unread     int    `json:"unread"`
+	LastAt     string `json:"last_at,omitempty"` // empty if the chat has no messages
+	LastSender string `json:"last_sender,omitempty"`
+	Preview    string `json:"preview,omitempty"`   // decrypted last message
+	LastSeen   string `json:"last_seen,omitempty"` // partner's users.last_login, personal chats only
 }
 
 type GroupMember struct {
@@ -28,3 +59,24 @@ type GroupMember struct {
 	JoinedAt string `json:"joined_at"`
 	Role     string `json:"role"`
 }
+
+// ChatEvent is the JSON payload published on the chat:<id> and group:<id>
+// Redis channels. SessionID lets the publishing connection skip its own echo.
+type ChatEvent struct {
+	Type      string `json:"type"` // MSG, REACTION, EDIT, DELETE, READ, TYPING, PIN, TOPIC, NOTICE, REMOVE
+	SessionID string `json:"session_id"`
+	Sender    string `json:"sender"`
+	MessageID int    `json:"message_id,omitempty"`
+	SentAt    string `json:"sent_at,omitempty"`
+	Content   string `json:"content,omitempty"` // message text or reaction emoji
+	ParentID  int    `json:"parent_id,omitempty"`
+}
+
+// InviteCode is a shareable code that lets whoever has it join a group
+type InviteCode struct {
+	Code      string `json:"code"`
+	GroupID   int    `json:"group_id"`
+	CreatedBy string `json:"created_by"`
+	UsesLeft  int    `json:"uses_left"` // -1 for no limit
+	ExpiresAt string `json:"expires_at"`
+}
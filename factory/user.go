@@ -7,4 +7,20 @@ type User struct {
 	Password       string `json:"password,omitempty"`
 	HashedPassword string `json:"hashed_password,omitempty"`
 	Created        string `json:"created"`
+	LastLogin      string `json:"last_login,omitempty"` // last time the user connected or disconnected
+}
+
+// SSHKey is a public key registered for SSH logins
+type SSHKey struct {
+	Fingerprint string `json:"fingerprint"` // SHA256:... as printed by ssh-keygen -l
+	PublicKey   string `json:"public_key"`  // authorized_keys line
+	Created     string `json:"created"`
+}
+
+// Ban keeps a user from logging in until Until (empty for a permanent ban)
+type Ban struct {
+	UserID   int    `json:"user_id"`
+	BannedBy string `json:"banned_by"`
+	Reason   string `json:"reason"`
+	Until    string `json:"until,omitempty"`
 }
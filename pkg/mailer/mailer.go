@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Mailer delivers plain-text mail such as password reset codes.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTP sends mail through an SMTP server. Auth is only used when Username
+// is set, so it can point at a local stand-in (MailHog, smtp4dev, ...).
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTP) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// Log writes mail to the log instead of sending it, for local development.
+type Log struct{}
+
+func (Log) Send(to, subject, body string) error {
+	slog.Info("Mail not sent, no smtp_addr configured", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// FromConfig returns an SMTP mailer for smtp_addr, or Log when it is unset.
+func FromConfig() Mailer {
+	addr := viper.GetString("smtp_addr")
+	if addr == "" {
+		slog.Warn("smtp_addr not set, mail will only be logged")
+		return Log{}
+	}
+	from := viper.GetString("smtp_from")
+	if from == "" {
+		from = "termchat@localhost"
+	}
+	return SMTP{
+		Addr:     addr,
+		From:     from,
+		Username: viper.GetString("smtp_user"),
+		Password: viper.GetString("smtp_password"),
+	}
+}
@@ -7,9 +7,11 @@ import (
 
 type Repository interface {
 	CreatePersonalChat(user1ID, user2ID int) (int, error)
-	SendPersonalMessage(senderUsername, receiverUsername, message, sessionID string) error
-	GetMessagesBetweenUsers(username1, username2 string) ([]factory.Message, error)
+	SendPersonalMessage(senderUsername, receiverUsername, message string, parentID int, sessionID string) (int, error)
+	GetMessagesBetweenUsers(username1, username2 string, beforeID, limit int) ([]factory.Message, error)
+	GetMessagesBefore(chatType string, chatID, beforeID, limit int) ([]factory.Message, error)
 	GetChatPartners(userID int) ([]string, error)
+	GetRoomSummaries(userID int) ([]factory.RoomSummary, error)
 	GetMessagesAfter(user1, user2 string, since time.Time) ([]*factory.Message, error)
 	GetChatID(user1, user2 string) (int, error)
 	GetLastMessagesBetweenUsers(user1, user2 string, limit int) ([]*factory.Message, error)
@@ -17,15 +19,36 @@ type Repository interface {
 	// Group Chat Methods
 	CreateGroupChat(name, description string, ownerID int) (int, error)
 	JoinGroupChat(userID, groupID int) error
-	LeaveGroupChat(userID, groupID int) error
-	GetGroupChatMessages(groupID int) ([]factory.Message, error)
-	SendGroupMessage(senderID, groupID int, message, sessionID string) error
+	LeaveGroupChat(userID, groupID int) (string, error)
+	TransferGroupOwnership(groupID, fromID, toID int) error
+	GetGroupChatMessages(groupID, beforeID, limit int) ([]factory.Message, error)
+	SendGroupMessage(senderID, groupID int, message string, parentID int, sessionID string) (int, error)
 	GetGroupChatID(name string) (int, error)
 	GetUserGroupChats(userID int) ([]factory.GroupChat, error)
 	GetGlobalChatID() (int, error)
 	IsGroupOwner(userID, groupID int) (bool, error)
 	AddGroupMember(userID, groupID int) error
 	RemoveGroupMember(userID, groupID int) error
+	GetGroupRole(userID, groupID int) (string, error)
+	SetGroupRole(userID, groupID int, role string) error
+	GetGroupChat(groupID int) (factory.GroupChat, error)
+	SetGroupTopic(groupID int, topic string) error
+	SetPinnedMessage(groupID, messageID int) error
+	SetGroupVisibility(groupID int, visibility string) error
+	AddGroupInvite(groupID, userID, invitedBy int) error
+	TakeGroupInvite(groupID, userID int) (bool, error)
+	AddJoinRequest(groupID, userID int) error
+	TakeJoinRequest(groupID, userID int) (bool, error)
+	GetJoinRequests(groupID int) ([]string, error)
+	GetGroupManagers(groupID int) ([]string, error)
 	AddReaction(messageID, userID int, emoji string) error
 	GetLastMessageID(chatType string, chatID int) (int, error)
+	GetMessageByID(messageID int) (factory.Message, error)
+	EditMessage(messageID, editorID int, newContent string) (factory.Message, error)
+	GetMessageEdits(messageID int) ([]factory.MessageEdit, error)
+	DeleteMessage(messageID, deletedBy int) error
+	PurgeUserMessages(userID, purgedBy int) ([]factory.Message, error)
+	GetThreadMessages(messageID int) ([]factory.Message, error)
+	MarkMessagesRead(chatType string, chatID, userID, upToID int) (int, error)
+	FindMessages(userID int, query, chatType string, chatID, limit int) ([]factory.MessageHit, error)
 }
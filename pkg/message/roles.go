@@ -0,0 +1,88 @@
+package message
+
+// Group member roles, from most to least powerful
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Things a group member may be allowed to do
+const (
+	ActionInvite       = "invite"
+	ActionKick         = "kick"
+	ActionPin          = "pin"
+	ActionDeleteOthers = "delete_others"
+	ActionEditTopic    = "edit_topic"
+	ActionPromote      = "promote"      // change other members' roles
+	ActionApprove      = "approve"      // answer join requests to private groups
+	ActionSettings     = "settings"     // change visibility
+	ActionInviteCodes  = "invite_codes" // list and revoke other members' invite codes
+)
+
+// permissions is the group permission matrix: which roles may do what
+var permissions = map[string][]string{
+	ActionInvite:       {RoleOwner, RoleAdmin, RoleModerator},
+	ActionKick:         {RoleOwner, RoleAdmin, RoleModerator},
+	ActionPin:          {RoleOwner, RoleAdmin, RoleModerator},
+	ActionDeleteOthers: {RoleOwner, RoleAdmin, RoleModerator},
+	ActionEditTopic:    {RoleOwner, RoleAdmin},
+	ActionPromote:      {RoleOwner, RoleAdmin},
+	ActionApprove:      {RoleOwner, RoleAdmin},
+	ActionSettings:     {RoleOwner, RoleAdmin},
+	ActionInviteCodes:  {RoleOwner, RoleAdmin},
+}
+
+// Group visibility: who may /join
+const (
+	VisibilityPublic     = "public"      // anyone
+	VisibilityPrivate    = "private"     // by request, approved by an owner or admin
+	VisibilityInviteOnly = "invite_only" // only with an invite
+)
+
+// ValidVisibility reports whether v is a known visibility
+func ValidVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityPrivate || v == VisibilityInviteOnly
+}
+
+// RoleRank orders roles; 0 means not a member (or an unknown role).
+func RoleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// ValidRole reports whether role can be handed out with /promote; owner
+// cannot, ownership is transferred instead.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleModerator || role == RoleMember
+}
+
+// Can reports whether a member with role may perform action.
+func Can(role, action string) bool {
+	for _, r := range permissions[action] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManage reports whether actor may act on a member with target's role
+// (kick them, change their role): actor needs the permission and must
+// outrank the target. For role changes newRole must be below actor too.
+func CanManage(actor, target, action, newRole string) bool {
+	if !Can(actor, action) || RoleRank(actor) <= RoleRank(target) {
+		return false
+	}
+	return newRole == "" || RoleRank(newRole) < RoleRank(actor)
+}
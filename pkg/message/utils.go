@@ -0,0 +1,34 @@
+package message
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseMentions returns the lower-cased usernames mentioned as @username in
+// text, each at most once.
+func ParseMentions(text string) map[string]bool {
+	mentions := make(map[string]bool)
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		name := strings.TrimRightFunc(word[1:], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+		})
+		if name != "" {
+			mentions[strings.ToLower(name)] = true
+		}
+	}
+	return mentions
+}
+
+// Preview shortens text to at most max runes on a single line for notices.
+func Preview(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
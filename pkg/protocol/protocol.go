@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions understood by the server.
+//
+// V1 is the original line format: space separated keywords followed by a
+// pipe separated payload (e.g. "HIST <ts>|<sender>|<content>|<reactions>").
+// It is kept for telnet users and is what every connection starts in.
+//
+// V2 sends exactly one JSON encoded Frame per line, so payload fields may
+// contain pipes, spaces or newlines without corrupting the stream.
+const (
+	V1     = 1
+	V2     = 2
+	Latest = V2
+)
+
+// Capabilities a client can ask for in its HELLO. Frames tied to a
+// capability are only sent to sessions that negotiated it.
+const (
+	CapReactions = "reactions"
+	CapReceipts  = "receipts" // live READ frames
+	CapTyping    = "typing"   // live TYPING frames
+)
+
+// ServerCaps lists every capability this server implements.
+var ServerCaps = []string{
+	CapReactions,
+	CapReceipts,
+	CapTyping,
+}
+
+// Frame is a single server → client line.
+//
+// Words are the space separated keywords after the verb ("OK CHAT READY"
+// has Verb "OK" and Words ["CHAT", "READY"]). Fields carry the payload
+// that V1 joins with '|'.
+type Frame struct {
+	Verb   string   `json:"verb"`
+	Words  []string `json:"words,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// NewFrame builds a frame from a verb and its keywords.
+func NewFrame(verb string, words ...string) Frame {
+	return Frame{Verb: verb, Words: words}
+}
+
+// With returns a copy of the frame carrying the given payload fields.
+func (f Frame) With(fields ...string) Frame {
+	f.Fields = fields
+	return f
+}
+
+// Word returns the i-th keyword or "" if it is missing.
+func (f Frame) Word(i int) string {
+	if i < 0 || i >= len(f.Words) {
+		return ""
+	}
+	return f.Words[i]
+}
+
+// Field returns the i-th payload field or "" if it is missing.
+func (f Frame) Field(i int) string {
+	if i < 0 || i >= len(f.Fields) {
+		return ""
+	}
+	return f.Fields[i]
+}
+
+// Encode renders the frame for the given protocol version, without the
+// trailing newline.
+func Encode(version int, f Frame) string {
+	if version >= V2 {
+		b, err := json.Marshal(f)
+		if err != nil {
+			// Frames only hold strings, so this cannot happen in practice.
+			return fmt.Sprintf(`{"verb":"ERR","words":["ENCODE"],"fields":[%q]}`, err.Error())
+		}
+		return string(b)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(f.Verb)
+	for _, w := range f.Words {
+		sb.WriteString(" ")
+		sb.WriteString(w)
+	}
+	if len(f.Fields) > 0 {
+		sb.WriteString(" ")
+		sb.WriteString(strings.Join(f.Fields, "|"))
+	}
+	// A raw newline would split the frame in two for a V1 reader.
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(sb.String())
+}
+
+// Decode parses a V2 line back into a Frame.
+func Decode(line string) (Frame, error) {
+	var f Frame
+	if err := json.Unmarshal([]byte(line), &f); err != nil {
+		return Frame{}, fmt.Errorf("invalid frame: %w", err)
+	}
+	if f.Verb == "" {
+		return Frame{}, fmt.Errorf("invalid frame: missing verb")
+	}
+	return f, nil
+}
+
+// IsFrame reports whether the line looks like a V2 frame.
+func IsFrame(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "{")
+}
+
+// Hello builds the HELLO line a client sends to open a session.
+func Hello(version int, caps ...string) string {
+	return strings.TrimSpace(fmt.Sprintf("HELLO %d %s", version, strings.Join(caps, " ")))
+}
+
+// ParseHello parses the arguments of "HELLO <version> <caps...>".
+func ParseHello(args string) (int, []string, error) {
+	parts := strings.Fields(args)
+	if len(parts) == 0 {
+		return 0, nil, fmt.Errorf("missing version")
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil || version < V1 {
+		return 0, nil, fmt.Errorf("invalid version %q", parts[0])
+	}
+	if version > Latest {
+		version = Latest
+	}
+	return version, parts[1:], nil
+}
+
+// Negotiate returns the capabilities present in both lists, in the
+// order the server declares them.
+func Negotiate(offered, supported []string) []string {
+	want := make(map[string]bool, len(offered))
+	for _, c := range offered {
+		want[strings.ToLower(c)] = true
+	}
+	var agreed []string
+	for _, c := range supported {
+		if want[c] {
+			agreed = append(agreed, c)
+		}
+	}
+	return agreed
+}
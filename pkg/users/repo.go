@@ -1,6 +1,9 @@
 package users
 
-import "termchat/factory"
+import (
+	"termchat/factory"
+	"time"
+)
 
 type Repository interface {
 	CreateUser(user factory.User) error
@@ -8,4 +11,18 @@ type Repository interface {
 	GetUser(email string) (factory.User, error)
 	GetUserByUsername(username string) (factory.User, error)
 	SearchUsersByName(name string) ([]factory.User, error)
+	UpdateLastLogin(userID int) error
+	UpdatePassword(email, hashedPassword string) error
+	ExportAccount(userID int) (factory.AccountExport, error)
+	DeleteAccount(userID int, purge bool) error
+	AddSSHKey(userID int, fingerprint, publicKey string) error
+	GetSSHKeys(userID int) ([]factory.SSHKey, error)
+	DeleteSSHKey(userID int, fingerprint string) error
+	HasSSHKey(username, fingerprint string) (bool, error)
+	RecordLockout(scope, subject, ip string, failures int, until time.Time) error
+	SetServerAdmin(email string, admin bool) error
+	IsServerAdmin(userID int) (bool, error)
+	BanUser(userID, bannedBy int, reason string, until *time.Time) error
+	UnbanUser(userID int) error
+	GetActiveBan(userID int) (*factory.Ban, error)
 }
@@ -3,10 +3,26 @@ package users
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is returned by Login for an unknown email as well as
+// a wrong password, so callers cannot tell which one it was
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// dummyHash is a bcrypt hash at the same cost as HashPassword. Checking a
+// password against it for unknown emails makes them take as long as a
+// wrong password for a real account.
+const dummyHash = "$2a$14$IBUhQ9ZFaAMZrT3pCbRhp.lD9ynGgOp/GenY1A5.Ih7oPUTJK5BwS"
+
+// BurnPasswordCheck spends the time of one VerifyPassword call without
+// matching anything.
+func BurnPasswordCheck(password string) {
+	_ = VerifyPassword(dummyHash, password)
+}
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"termchat/factory"
+	"termchat/pkg/protocol"
+	"time"
+)
+
+// confirmTTL is how long the code from /account delete stays valid
+const confirmTTL = 2 * time.Minute
+
+// exportChunk is the raw size of one EXPORT frame, well below the 1MB
+// line limit of the client once base64 encoded
+const exportChunk = 48 << 10
+
+// pendingDelete is an /account delete waiting for its confirmation code
+type pendingDelete struct {
+	purge   bool
+	code    string
+	expires time.Time
+}
+
+func newPendingDelete(purge bool) (*pendingDelete, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
+	}
+	return &pendingDelete{purge: purge, code: hex.EncodeToString(b), expires: time.Now().Add(confirmTTL)}, nil
+}
+
+// matches reports whether code confirms this request in time
+func (p *pendingDelete) matches(code string) bool {
+	return p != nil && p.code == code && time.Now().Before(p.expires)
+}
+
+// deleteAccount removes user (purging or anonymizing their messages) and
+// ends all of their sessions.
+func (s *Server) deleteAccount(user *factory.User, purge bool) error {
+	if err := s.user.DeleteAccount(int(user.ID), purge); err != nil {
+		return err
+	}
+	s.revokeSessions(user.Email, "")
+	_ = s.redis.ClearAllPresence(user.Name)
+	return nil
+}
+
+// sendExport streams the user's data export as base64 chunks:
+//
+//	← OK EXPORT <filename>
+//	← EXPORT <base64 chunk>   (repeated)
+//	← OK EXPORT END <bytes>
+func (s *Server) sendExport(conn *clientConn, user *factory.User) error {
+	export, err := s.user.ExportAccount(int(user.ID))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	conn.ok("EXPORT", fmt.Sprintf("termchat-%s-%s.json", user.Name, time.Now().Format("20060102")))
+	for start := 0; start < len(data); start += exportChunk {
+		end := min(start+exportChunk, len(data))
+		conn.send(protocol.NewFrame("EXPORT", base64.StdEncoding.EncodeToString(data[start:end])))
+	}
+	conn.ok("EXPORT", "END", strconv.Itoa(len(data)))
+	return nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Brute-force protection for /login, /register and SSH passwords. Failures
+// are counted per account and per IP in Redis. After a few free attempts
+// every further failure blocks the key with an exponential backoff, and
+// enough of them lock it out for a while.
+const (
+	authWindow          = 15 * time.Minute // failures older than this are forgotten
+	authFreeAttempts    = 3
+	authMaxBackoff      = 5 * time.Minute
+	accountLockoutAfter = 10
+	ipLockoutAfter      = 50
+	authLockoutFor      = 15 * time.Minute
+
+	registerRate  = 3.0 / 3600 // sign-ups per second and IP
+	registerBurst = 3
+)
+
+// remoteIP returns the host part of a connection's remote address.
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func accountKey(email string) string {
+	return "acct:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginBlockedFor returns how long logins for email from ip are refused.
+func (s *Server) loginBlockedFor(email, ip string) time.Duration {
+	var wait time.Duration
+	for _, key := range []string{accountKey(email), "ip:" + ip} {
+		d, err := s.redis.AuthBlockedFor(key)
+		if err != nil {
+			s.logger.Error("Auth block check failed", "error", err)
+			continue
+		}
+		wait = max(wait, d)
+	}
+	return wait
+}
+
+// loginFailed counts a failed login and backs off or locks out the account
+// and the IP.
+func (s *Server) loginFailed(email, ip string) {
+	s.authFailure("account", accountKey(email), email, ip, accountLockoutAfter)
+	s.authFailure("ip", "ip:"+ip, ip, ip, ipLockoutAfter)
+}
+
+// loginSucceeded clears the account's failures. The IP keeps its count, so
+// one valid account cannot be used to reset guessing against others.
+func (s *Server) loginSucceeded(email string) {
+	_ = s.redis.ResetAuthFailures(accountKey(email))
+}
+
+func (s *Server) authFailure(scope, key, subject, ip string, lockoutAfter int64) {
+	failures, err := s.redis.RecordAuthFailure(key, authWindow)
+	if err != nil {
+		s.logger.Error("Failed to record auth failure", "error", err)
+		return
+	}
+	if failures < authFreeAttempts {
+		return
+	}
+	if failures >= lockoutAfter {
+		s.lockout(scope, key, subject, ip, int(failures), authLockoutFor)
+		return
+	}
+	backoff := min(time.Second<<(failures-authFreeAttempts), authMaxBackoff)
+	_ = s.redis.BlockAuth(key, backoff)
+}
+
+// lockout blocks key for d and records the event.
+func (s *Server) lockout(scope, key, subject, ip string, failures int, d time.Duration) {
+	if err := s.redis.BlockAuth(key, d); err != nil {
+		s.logger.Error("Failed to lock out", "error", err)
+		return
+	}
+	s.logger.Warn("Auth lockout", "scope", scope, "subject", subject, "ip", ip, "failures", failures)
+	if err := s.user.RecordLockout(scope, subject, ip, failures, time.Now().Add(d)); err != nil {
+		s.logger.Error("Failed to record lockout", "error", err)
+	}
+}
+
+// allowRegister throttles sign-ups per IP. It returns how long to wait when
+// the IP is over the limit.
+func (s *Server) allowRegister(ip string) (bool, time.Duration) {
+	if d, err := s.redis.AuthBlockedFor("register:" + ip); err == nil && d > 0 {
+		return false, d
+	}
+	ok, wait, err := s.redis.TakeToken("register:"+ip, registerRate, registerBurst)
+	if err != nil {
+		s.logger.Error("Register throttle failed", "error", err)
+		return true, 0
+	}
+	if !ok {
+		s.lockout("register", "register:"+ip, ip, ip, registerBurst, wait)
+		return false, wait
+	}
+	return true, 0
+}
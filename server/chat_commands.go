@@ -0,0 +1,449 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"termchat/factory"
+	msgpkg "termchat/pkg/message"
+	"termchat/pkg/protocol"
+)
+
+// historyPageSize is how many messages /chat, /group and /more send at once.
+const historyPageSize = 50
+
+// findLimit caps the number of /find results.
+const findLimit = 20
+
+// chatRoom identifies the conversation an in-chat command applies to.
+type chatRoom struct {
+	chatType string // "personal" or "group"
+	chatID   int
+	channel  string // Redis channel: chat:<id> or group:<id>
+	partner  string // the other user, personal chats only
+}
+
+func personalRoom(chatID int, partner string) chatRoom {
+	return chatRoom{chatType: "personal", chatID: chatID, channel: fmt.Sprintf("chat:%d", chatID), partner: partner}
+}
+
+func groupRoom(groupID int) chatRoom {
+	return chatRoom{chatType: "group", chatID: groupID, channel: fmt.Sprintf("group:%d", groupID)}
+}
+
+// publishChatEvent publishes an event on the room's Redis channel.
+func (s *Server) publishChatEvent(room chatRoom, event factory.ChatEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_ = s.redis.Client.Publish(context.Background(), room.channel, payload).Err()
+}
+
+// sendRoomMessage stores and publishes a message in the room, optionally as
+// a reply to parentID.
+func (s *Server) sendRoomMessage(user *factory.User, room chatRoom, content string, parentID int, sessionID string) (int, error) {
+	if room.chatType == "group" {
+		return s.message.SendGroupMessage(int(user.ID), room.chatID, content, parentID, sessionID)
+	}
+	return s.message.SendPersonalMessage(user.Name, room.partner, content, parentID, sessionID)
+}
+
+// markRead records that user has seen the room up to upToID and tells the
+// other participants with a READ event.
+func (s *Server) markRead(user *factory.User, room chatRoom, upToID int, sessionID string) {
+	if upToID == 0 {
+		return
+	}
+	lastID, err := s.message.MarkMessagesRead(room.chatType, room.chatID, int(user.ID), upToID)
+	if err != nil || lastID == 0 {
+		return
+	}
+	s.publishChatEvent(room, factory.ChatEvent{
+		Type:      "READ",
+		SessionID: sessionID,
+		Sender:    user.Name,
+		MessageID: lastID,
+	})
+}
+
+// handleChatCommand runs a slash command typed inside /chat or /group.
+// It returns false when the line is not an in-chat command and should be
+// sent as a message instead.
+func handleChatCommand(conn *clientConn, srv *Server, currentUser *factory.User, room chatRoom, sessionID, line string) bool {
+	args := strings.SplitN(line, " ", 2)
+	argLine := ""
+	if len(args) > 1 {
+		argLine = strings.TrimSpace(args[1])
+	}
+
+	switch args[0] {
+
+	// /typing — transient signal, only fanned out over Redis and never acked
+	case "/typing":
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:      "TYPING",
+			SessionID: sessionID,
+			Sender:    currentUser.Name,
+		})
+		return true
+
+	// /react [<id>] <emoji> — without an ID the last message is used
+	case "/react":
+		parts := strings.Fields(argLine)
+		var messageID int
+		var emoji string
+		switch len(parts) {
+		case 1:
+			id, err := srv.message.GetLastMessageID(room.chatType, room.chatID)
+			if err != nil {
+				conn.fail("", "REACT", "no_messages")
+				return true
+			}
+			messageID, emoji = id, parts[0]
+		case 2:
+			id, err := strconv.Atoi(parts[0])
+			if err != nil {
+				conn.fail("", "REACT", "invalid_id")
+				return true
+			}
+			messageID, emoji = id, parts[1]
+		default:
+			conn.fail("", "REACT", "invalid_arguments")
+			return true
+		}
+
+		target, ok := lookupRoomMessage(conn, srv, room, messageID, "REACT")
+		if !ok {
+			return true
+		}
+		if target.DeletedAt != "" {
+			conn.fail("", "REACT", "message_deleted")
+			return true
+		}
+		if err := srv.message.AddReaction(messageID, int(currentUser.ID), emoji); err != nil {
+			conn.fail(err.Error(), "REACT")
+			return true
+		}
+		conn.ok("REACT", strconv.Itoa(messageID), emoji)
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:      "REACTION",
+			SessionID: sessionID,
+			Sender:    currentUser.Name,
+			MessageID: messageID,
+			Content:   emoji,
+		})
+		return true
+
+	// /edit <id> <new text> — sender only, prior text is kept as a revision
+	case "/edit":
+		parts := strings.SplitN(argLine, " ", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			conn.fail("", "EDIT", "invalid_arguments")
+			return true
+		}
+		messageID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			conn.fail("", "EDIT", "invalid_id")
+			return true
+		}
+		msg, ok := lookupRoomMessage(conn, srv, room, messageID, "EDIT")
+		if !ok {
+			return true
+		}
+		if msg.DeletedAt != "" {
+			conn.fail("", "EDIT", "message_deleted")
+			return true
+		}
+		if msg.SenderID != int(currentUser.ID) {
+			conn.fail("", "EDIT", "not_authorized")
+			return true
+		}
+		edited, err := srv.message.EditMessage(messageID, int(currentUser.ID), strings.TrimSpace(parts[1]))
+		if err != nil {
+			conn.fail(err.Error(), "EDIT")
+			return true
+		}
+		conn.send(protocol.NewFrame("OK", "EDIT", strconv.Itoa(messageID)).With(edited.Content))
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:      "EDIT",
+			SessionID: sessionID,
+			Sender:    currentUser.Name,
+			MessageID: messageID,
+			SentAt:    edited.EditedAt,
+			Content:   edited.Content,
+		})
+		return true
+
+	// /edits <id> — list prior revisions of a message
+	case "/edits":
+		messageID, err := strconv.Atoi(argLine)
+		if err != nil {
+			conn.fail("", "EDITS", "invalid_id")
+			return true
+		}
+		if _, ok := lookupRoomMessage(conn, srv, room, messageID, "EDITS"); !ok {
+			return true
+		}
+		edits, err := srv.message.GetMessageEdits(messageID)
+		if err != nil {
+			conn.fail(err.Error(), "EDITS")
+			return true
+		}
+		for _, e := range edits {
+			conn.send(protocol.NewFrame("EDITS").With(strconv.Itoa(e.MessageID), e.EditedAt, e.Content))
+		}
+		conn.ok("EDITS", strconv.Itoa(messageID), strconv.Itoa(len(edits)))
+		return true
+
+	// /delete <id> — sender, or inside a group a member whose role allows
+	// deleting others' messages, or a server admin
+	case "/delete":
+		messageID, err := strconv.Atoi(argLine)
+		if err != nil {
+			conn.fail("", "DELETE", "invalid_id")
+			return true
+		}
+		msg, ok := lookupRoomMessage(conn, srv, room, messageID, "DELETE")
+		if !ok {
+			return true
+		}
+		if msg.DeletedAt != "" {
+			conn.fail("", "DELETE", "message_deleted")
+			return true
+		}
+		allowed := msg.SenderID == int(currentUser.ID)
+		if !allowed && room.chatType == "group" {
+			allowed = srv.groupCan(currentUser, room.chatID, msgpkg.ActionDeleteOthers)
+		}
+		if !allowed && room.chatType == "group" {
+			allowed, _ = srv.user.IsServerAdmin(int(currentUser.ID))
+		}
+		if !allowed {
+			conn.fail("", "DELETE", "not_authorized")
+			return true
+		}
+		if err := srv.message.DeleteMessage(messageID, int(currentUser.ID)); err != nil {
+			conn.fail(err.Error(), "DELETE")
+			return true
+		}
+		conn.ok("DELETE", strconv.Itoa(messageID))
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:      "DELETE",
+			SessionID: sessionID,
+			Sender:    currentUser.Name,
+			MessageID: messageID,
+		})
+		return true
+
+	// /pin <id>, /unpin — group only, for roles with the pin permission
+	case "/pin", "/unpin":
+		verb := strings.ToUpper(strings.TrimPrefix(args[0], "/"))
+		if room.chatType != "group" {
+			conn.fail("", verb, "not_a_group")
+			return true
+		}
+		if !srv.groupCan(currentUser, room.chatID, msgpkg.ActionPin) {
+			conn.fail("", verb, "not_authorized")
+			return true
+		}
+		var msg factory.Message
+		if args[0] == "/pin" {
+			messageID, err := strconv.Atoi(argLine)
+			if err != nil {
+				conn.fail("", verb, "invalid_id")
+				return true
+			}
+			var ok bool
+			if msg, ok = lookupRoomMessage(conn, srv, room, messageID, verb); !ok {
+				return true
+			}
+			if msg.DeletedAt != "" {
+				conn.fail("", verb, "message_deleted")
+				return true
+			}
+		}
+		if err := srv.message.SetPinnedMessage(room.chatID, msg.ID); err != nil {
+			conn.fail(err.Error(), verb)
+			return true
+		}
+		conn.ok(verb, strconv.Itoa(msg.ID))
+		// Sender is the author of the pinned message here, empty on unpin.
+		// No SessionID: this session shows the pin from the event as well.
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:      "PIN",
+			Sender:    msg.SenderName,
+			MessageID: msg.ID,
+			Content:   msg.Content,
+		})
+		return true
+
+	// /topic <text> — group only, for roles allowed to edit the topic
+	case "/topic":
+		if room.chatType != "group" {
+			conn.fail("", "TOPIC", "not_a_group")
+			return true
+		}
+		if !srv.groupCan(currentUser, room.chatID, msgpkg.ActionEditTopic) {
+			conn.fail("", "TOPIC", "not_authorized")
+			return true
+		}
+		if err := srv.message.SetGroupTopic(room.chatID, argLine); err != nil {
+			conn.fail(err.Error(), "TOPIC")
+			return true
+		}
+		conn.ok("TOPIC")
+		srv.publishChatEvent(room, factory.ChatEvent{
+			Type:    "TOPIC",
+			Sender:  currentUser.Name,
+			Content: argLine,
+		})
+		return true
+
+	// /reply <id> <text> — answer a message, starting or extending its thread
+	case "/reply":
+		parts := strings.SplitN(argLine, " ", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			conn.fail("", "REPLY", "invalid_arguments")
+			return true
+		}
+		parentID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			conn.fail("", "REPLY", "invalid_id")
+			return true
+		}
+		parent, ok := lookupRoomMessage(conn, srv, room, parentID, "REPLY")
+		if !ok {
+			return true
+		}
+		if parent.DeletedAt != "" {
+			conn.fail("", "REPLY", "message_deleted")
+			return true
+		}
+		if !srv.allowSend(conn, currentUser.Name, room.channel) {
+			return true
+		}
+		id, err := srv.sendRoomMessage(currentUser, room, strings.TrimSpace(parts[1]), parentID, sessionID)
+		if err != nil {
+			conn.fail(err.Error(), "REPLY", "send_failed")
+			return true
+		}
+		conn.ok("SENT", strconv.Itoa(id))
+		return true
+
+	// /more <before-id> — the page of history just before a message
+	case "/more":
+		beforeID, err := strconv.Atoi(argLine)
+		if err != nil || beforeID <= 0 {
+			conn.fail("", "MORE", "invalid_id")
+			return true
+		}
+		messages, err := srv.message.GetMessagesBefore(room.chatType, room.chatID, beforeID, historyPageSize)
+		if err != nil {
+			conn.fail(err.Error(), "MORE")
+			return true
+		}
+		conn.ok("MORE", strconv.Itoa(beforeID))
+		for _, m := range messages {
+			conn.send(histFrame(m))
+		}
+		conn.ok("MORE", "END", strconv.Itoa(len(messages)))
+		return true
+
+	// /thread <id> — replay only the thread the message belongs to
+	case "/thread":
+		messageID, err := strconv.Atoi(argLine)
+		if err != nil {
+			conn.fail("", "THREAD", "invalid_id")
+			return true
+		}
+		if _, ok := lookupRoomMessage(conn, srv, room, messageID, "THREAD"); !ok {
+			return true
+		}
+		messages, err := srv.message.GetThreadMessages(messageID)
+		if err != nil {
+			conn.fail(err.Error(), "THREAD")
+			return true
+		}
+		root := messages[0]
+		for _, m := range messages {
+			if m.ParentID == 0 {
+				root = m
+				break
+			}
+		}
+		conn.ok("THREAD", strconv.Itoa(root.ID))
+		for _, m := range messages {
+			conn.send(histFrame(m))
+		}
+		conn.ok("THREAD", "READY")
+		return true
+	}
+
+	return false
+}
+
+// lookupRoomMessage fetches a message and makes sure it belongs to the room
+// the user is in, so IDs from other conversations cannot be targeted.
+func lookupRoomMessage(conn *clientConn, srv *Server, room chatRoom, messageID int, verb string) (factory.Message, bool) {
+	msg, err := srv.message.GetMessageByID(messageID)
+	if err != nil || msg.ChatType != room.chatType || msg.ChatID != room.chatID {
+		conn.fail("", verb, "message_not_found")
+		return factory.Message{}, false
+	}
+	return msg, true
+}
+
+// forwardChatEvent relays a chat:<id> / group:<id> Redis event to the
+// client, skipping events published by this very session. It returns the
+// decoded event and whether it was relayed.
+func forwardChatEvent(conn *clientConn, payload, mySessionID string) (factory.ChatEvent, bool) {
+	var event factory.ChatEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return event, false
+	}
+	// Skip our own session's events (already echoed optimistically on client)
+	if event.SessionID == mySessionID {
+		return event, false
+	}
+
+	id := strconv.Itoa(event.MessageID)
+	switch event.Type {
+	case "MSG":
+		conn.send(protocol.NewFrame("MSG").With(id, event.Sender, event.SentAt, event.Content, parentRef(event.ParentID)))
+	case "EDIT":
+		conn.send(protocol.NewFrame("EDIT").With(id, event.Sender, event.SentAt, event.Content))
+	case "DELETE":
+		conn.send(protocol.NewFrame("DELETE").With(id, event.Sender))
+	case "REACTION":
+		if conn.has(protocol.CapReactions) {
+			conn.send(protocol.NewFrame("REACTION").With(id, event.Sender, event.Content))
+		}
+	case "READ":
+		if conn.has(protocol.CapReceipts) {
+			conn.send(protocol.NewFrame("READ", id, event.Sender))
+		}
+	case "TYPING":
+		if conn.has(protocol.CapTyping) {
+			conn.send(protocol.NewFrame("TYPING", event.Sender))
+		}
+	case "PIN":
+		conn.send(protocol.NewFrame("PIN").With(id, event.Sender, event.Content))
+	case "TOPIC":
+		conn.send(protocol.NewFrame("TOPIC").With(event.Sender, event.Content))
+	case "NOTICE":
+		conn.send(protocol.NewFrame("NOTICE").With(event.Content))
+	}
+	return event, true
+}
+
+// parentRef renders a parent message ID for HIST/MSG frames, empty for
+// top-level messages.
+func parentRef(parentID int) string {
+	if parentID == 0 {
+		return ""
+	}
+	return strconv.Itoa(parentID)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"errors"
+	"termchat/factory"
+)
+
+// errNotMember is returned by authorizeGroup for users outside the group
+var errNotMember = errors.New("not a member of the group")
+
+// authorizeGroup is the one check in front of every group read, send,
+// reaction and history page: the user must be a member, except in the
+// global room which everyone is in. Kicks take effect on the next check,
+// and removeFromGroup makes that happen right away for open rooms.
+func (s *Server) authorizeGroup(user *factory.User, groupID int) error {
+	if user == nil {
+		return errNotMember
+	}
+	if s.groupRole(int(user.ID), groupID) != "" {
+		return nil
+	}
+	g, err := s.message.GetGroupChat(groupID)
+	if err != nil {
+		return err
+	}
+	if g.IsGlobal {
+		return nil
+	}
+	return errNotMember
+}
+
+// removeFromGroup closes the group's live room for username on every
+// session that has it open; see handleGroupChat.
+func (s *Server) removeFromGroup(groupID int, username string) {
+	s.publishChatEvent(groupRoom(groupID), factory.ChatEvent{Type: "REMOVE", Sender: username})
+}
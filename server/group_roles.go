@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strconv"
+	"termchat/factory"
+	msgpkg "termchat/pkg/message"
+	"termchat/pkg/protocol"
+	"time"
+)
+
+// groupRole returns the user's role in the group, empty for non-members
+// and on lookup errors.
+func (s *Server) groupRole(userID, groupID int) string {
+	role, err := s.message.GetGroupRole(userID, groupID)
+	if err != nil {
+		s.logger.Error("Failed to get group role", "error", err)
+	}
+	return role
+}
+
+// groupCan reports whether the user's role in the group allows action
+func (s *Server) groupCan(user *factory.User, groupID int, action string) bool {
+	return msgpkg.Can(s.groupRole(int(user.ID), groupID), action)
+}
+
+// Invite code limits: a code is good for one use within a day unless
+// /invitecode says otherwise, and never for more than 30 days.
+const (
+	inviteCodeUses   = 1
+	inviteCodeTTL    = 24 * time.Hour
+	inviteCodeMaxTTL = 30 * 24 * time.Hour
+)
+
+// groupNotice tells everyone in the group's live room about a change,
+// e.g. a new owner:
+//
+//	← NOTICE |<text>
+func (s *Server) groupNotice(groupID int, text string) {
+	s.publishChatEvent(groupRoom(groupID), factory.ChatEvent{Type: "NOTICE", Content: text})
+}
+
+// sendGroupInfo sends the topic and pinned message of a group being opened:
+//
+//	← TOPIC |<topic>
+//	← PIN <id>|<author>|<content>
+func (s *Server) sendGroupInfo(conn *clientConn, groupID int) {
+	g, err := s.message.GetGroupChat(groupID)
+	if err != nil {
+		return
+	}
+	if g.Description != "" {
+		conn.send(protocol.NewFrame("TOPIC").With("", g.Description))
+	}
+	if g.PinnedMessageID == 0 {
+		return
+	}
+	if m, err := s.message.GetMessageByID(g.PinnedMessageID); err == nil && m.DeletedAt == "" {
+		conn.send(protocol.NewFrame("PIN").With(strconv.Itoa(m.ID), m.SenderName, m.Content))
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"termchat/factory"
+	"termchat/pkg/protocol"
+	"time"
+)
+
+// announceChannel carries /announce frames to every logged in session
+const announceChannel = "announce"
+
+// requireAdmin replies with an error unless user is a server admin. The
+// flag is read fresh so revoking it takes effect at once.
+func (s *Server) requireAdmin(conn *clientConn, user *factory.User, verb string) bool {
+	if user == nil {
+		conn.fail("", "AUTH", "not_logged_in")
+		return false
+	}
+	admin, err := s.user.IsServerAdmin(int(user.ID))
+	if err != nil {
+		conn.fail(err.Error(), verb)
+		return false
+	}
+	if !admin {
+		conn.fail("", verb, "not_authorized")
+		return false
+	}
+	return true
+}
+
+// banned replies ERR <verb> banned <until=...|permanent> | <reason> when
+// the user is banned. Errors count as banned so a database hiccup does not
+// let anyone in.
+func (s *Server) banned(conn *clientConn, verb string, userID int) bool {
+	ban, err := s.user.GetActiveBan(userID)
+	if err != nil {
+		conn.fail(err.Error(), verb)
+		return true
+	}
+	if ban == nil {
+		return false
+	}
+	conn.fail(ban.Reason, verb, "banned", banUntil(ban.Until))
+	return true
+}
+
+func banUntil(until string) string {
+	if until == "" {
+		return "permanent"
+	}
+	return "until=" + until
+}
+
+// parseDuration is time.ParseDuration that also takes days, e.g. "7d"
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// moderatedRoom resolves a room name for /mute: "global" or a group name.
+func (s *Server) moderatedRoom(name string) (chatRoom, error) {
+	if strings.EqualFold(name, "global") {
+		id, err := s.message.GetGlobalChatID()
+		if err != nil {
+			return chatRoom{}, err
+		}
+		return groupRoom(id), nil
+	}
+	id, err := s.message.GetGroupChatID(name)
+	if err != nil {
+		return chatRoom{}, err
+	}
+	return groupRoom(id), nil
+}
+
+// roomMuted refuses a send from who in room while a /mute is in force
+func (s *Server) roomMuted(conn *clientConn, who, room string) bool {
+	muted, left, err := s.redis.MutedInRoom(room, who)
+	if err != nil {
+		s.logger.Error("Room mute check failed", "error", err)
+		return false
+	}
+	if !muted {
+		return false
+	}
+	if left > 0 {
+		conn.fail("", "MUTED", retryAfter(left))
+	} else {
+		conn.fail("", "MUTED")
+	}
+	return true
+}
+
+// announce sends an admin's message to every logged in session
+func (s *Server) announce(from, text string) error {
+	f := protocol.NewFrame("NOTIFY", "ANNOUNCE").With(from, text)
+	return s.redis.Client.Publish(context.Background(), announceChannel, protocol.Encode(protocol.V2, f)).Err()
+}
+
+// purgeMessages tombstones everything user sent and tells the rooms
+// involved, so open chats drop the messages right away.
+func (s *Server) purgeMessages(user factory.User, by *factory.User) (int, error) {
+	purged, err := s.message.PurgeUserMessages(int(user.ID), int(by.ID))
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range purged {
+		room := groupRoom(m.ChatID)
+		if m.ChatType == "personal" {
+			room = personalRoom(m.ChatID, "")
+		}
+		s.publishChatEvent(room, factory.ChatEvent{Type: "DELETE", Sender: by.Name, MessageID: m.ID})
+	}
+	return len(purged), nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"termchat/pkg/users"
+)
+
+// minPasswordLen is the shortest password /passwd and /reset accept
+const minPasswordLen = 8
+
+// resetMailRate limits reset mails per account, so /forgot cannot be used
+// to flood someone's inbox.
+const (
+	resetMailRate  = 3.0 / 3600 // per second
+	resetMailBurst = 3
+)
+
+// setPassword stores a new password for email and ends every other session
+// of the account, keeping only keep (empty to end them all).
+func (s *Server) setPassword(email, password, keep string) error {
+	if len(password) < minPasswordLen {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLen)
+	}
+	hashed, err := users.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.user.UpdatePassword(email, hashed); err != nil {
+		return err
+	}
+	s.revokeSessions(email, keep)
+	return nil
+}
+
+// sendResetCode mails a single-use reset code to email if it belongs to an
+// account. Nothing is reported back so the reply does not reveal which
+// addresses are registered.
+func (s *Server) sendResetCode(email, ip string) {
+	if ok, _, err := s.redis.TakeToken("reset:"+accountKey(email), resetMailRate, resetMailBurst); err == nil && !ok {
+		s.logger.Warn("Reset mail throttled", "email", email, "ip", ip)
+		return
+	}
+	if _, err := s.user.GetUser(email); err != nil {
+		return
+	}
+	code, err := s.redis.StoreEmailHash(email)
+	if err != nil {
+		s.logger.Error("Failed to store reset code", "error", err)
+		return
+	}
+	body := "Someone asked to reset your TermChat password.\n\n" +
+		"Reset code: " + code + "\n\n" +
+		"Type /reset " + code + " <new password> (or press F2 on the sign-in screen).\n" +
+		"The code is valid for 30 minutes. If this wasn't you, ignore this mail.\n"
+	if err := s.mailer.Send(email, "TermChat password reset", body); err != nil {
+		s.logger.Error("Failed to send reset mail", "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"termchat/db/redis"
+	"time"
+)
+
+const (
+	presenceTTL  = 60 * time.Second // session presence lifetime without a heartbeat
+	presenceBeat = 20 * time.Second // heartbeat interval
+	awayAfter    = 5 * time.Minute  // idle time before a user shows as away
+)
+
+// trackPresence keeps this session of username present while the connection
+// is up, switching between online and away based on client activity.
+func (s *Server) trackPresence(ctx context.Context, conn *clientConn, username, sessionID string) {
+	ticker := time.NewTicker(presenceBeat)
+	defer ticker.Stop()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		status := redis.PresenceOnline
+		if conn.idleFor() > awayAfter {
+			status = redis.PresenceAway
+		}
+		if err := s.redis.SetPresence(username, sessionID, status, presenceTTL); err != nil {
+			s.logger.Error("Presence heartbeat failed", "user", username, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// presenceOf looks up the state of each user, treating lookup errors as
+// offline.
+func (s *Server) presenceOf(usernames ...string) map[string]string {
+	states, err := s.redis.GetPresence(usernames...)
+	if err != nil {
+		s.logger.Error("Presence lookup failed", "error", err)
+		states = make(map[string]string, len(usernames))
+		for _, name := range usernames {
+			states[name] = redis.PresenceOffline
+		}
+	}
+	return states
+}
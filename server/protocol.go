@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"termchat/pkg/protocol"
+	"time"
+)
+
+// clientConn wraps a TCP connection with the protocol version and
+// capabilities negotiated through HELLO. Every write goes through send so
+// frames written from the pub/sub goroutines never interleave.
+type clientConn struct {
+	net.Conn
+
+	mu         sync.Mutex
+	version    int
+	caps       map[string]bool
+	lastActive atomic.Int64 // unix nanos of the last read, for away detection
+}
+
+func newClientConn(conn net.Conn) *clientConn {
+	c := &clientConn{Conn: conn, version: protocol.V1, caps: map[string]bool{}}
+	c.lastActive.Store(time.Now().UnixNano())
+	return c
+}
+
+// Read records activity before reading from the connection.
+func (c *clientConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.lastActive.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// idleFor returns how long the client has not sent anything.
+func (c *clientConn) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastActive.Load()))
+}
+
+// send writes a single frame using the session's protocol version.
+func (c *clientConn) send(f protocol.Frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Conn.Write([]byte(protocol.Encode(c.version, f) + "\n"))
+}
+
+// ok writes an "OK <words...>" frame.
+func (c *clientConn) ok(words ...string) {
+	c.send(protocol.NewFrame("OK", words...))
+}
+
+// fail writes an "ERR <words...> <detail>" frame. detail may be empty.
+func (c *clientConn) fail(detail string, words ...string) {
+	f := protocol.NewFrame("ERR", words...)
+	if detail != "" {
+		f = f.With(detail)
+	}
+	c.send(f)
+}
+
+// text writes free-form text meant for humans on a telnet session.
+// V2 clients parse frames only, so the text is dropped for them.
+func (c *clientConn) text(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version >= protocol.V2 {
+		return
+	}
+	c.Conn.Write([]byte(s))
+}
+
+// prompt writes the "> " input prompt for legacy telnet sessions.
+func (c *clientConn) prompt() {
+	c.text("> ")
+}
+
+// has reports whether the session negotiated the given capability.
+func (c *clientConn) has(capability string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.caps[capability]
+}
+
+// hello handles "HELLO <version> <caps...>" and switches the session to the
+// negotiated framing. The reply is already written in the new version.
+func (c *clientConn) hello(argLine string) {
+	version, offered, err := protocol.ParseHello(argLine)
+	if err != nil {
+		c.fail(err.Error(), "HELLO")
+		return
+	}
+	agreed := protocol.Negotiate(offered, protocol.ServerCaps)
+
+	c.mu.Lock()
+	c.version = version
+	c.caps = make(map[string]bool, len(agreed))
+	for _, capability := range agreed {
+		c.caps[capability] = true
+	}
+	c.mu.Unlock()
+
+	c.send(protocol.NewFrame("HELLO", append([]string{strconv.Itoa(version)}, agreed...)...))
+}
+
+// publishNotify sends a frame to a user's notification channel. The frame is
+// stored as V2 JSON so the receiving session can re-encode it for its own
+// protocol version.
+func (s *Server) publishNotify(username string, f protocol.Frame) {
+	_ = s.redis.Client.Publish(context.Background(), notifyChannel(username), protocol.Encode(protocol.V2, f)).Err()
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"termchat/factory"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// bucket is a token bucket: rate tokens per second, at most burst saved up.
+type bucket struct {
+	rate  float64
+	burst int
+}
+
+// rateLimits holds the configured limits. conn applies to every line a
+// connection sends, user and room to chat messages only. A user that hits
+// a limit strikes times within strikeWindow is muted for muteFor.
+type rateLimits struct {
+	conn, user, room bucket
+	strikes          int64
+	strikeWindow     time.Duration
+	muteFor          time.Duration
+}
+
+// loadRateLimits reads rate_limits.* from the config, e.g.
+//
+//	"rate_limits": {"user": {"rate": 1, "burst": 5}, "mute_for": "10m"}
+func loadRateLimits() rateLimits {
+	get := func(name string, rate float64, burst int) bucket {
+		if r := viper.GetFloat64("rate_limits." + name + ".rate"); r > 0 {
+			rate = r
+		}
+		if b := viper.GetInt("rate_limits." + name + ".burst"); b > 0 {
+			burst = b
+		}
+		return bucket{rate: rate, burst: burst}
+	}
+	duration := func(name string, def time.Duration) time.Duration {
+		if d := viper.GetDuration("rate_limits." + name); d > 0 {
+			return d
+		}
+		return def
+	}
+	strikes := viper.GetInt64("rate_limits.strikes")
+	if strikes <= 0 {
+		strikes = 5
+	}
+	return rateLimits{
+		conn:         get("conn", 5, 20),
+		user:         get("user", 2, 10),
+		room:         get("room", 20, 40),
+		strikes:      strikes,
+		strikeWindow: duration("strike_window", time.Minute),
+		muteFor:      duration("mute_for", 5*time.Minute),
+	}
+}
+
+// allowLine charges one line to the connection's bucket. sessionID names
+// the connection.
+func (s *Server) allowLine(conn *clientConn, who, sessionID string) bool {
+	return s.take(conn, who, "conn:"+sessionID, s.limits.conn)
+}
+
+// allowSend is checked before a chat message is stored and fanned out:
+// auto-muted users and users an admin muted in the room are refused, then
+// the user's and the room's buckets are charged. room is the Redis
+// channel, empty when there is none.
+func (s *Server) allowSend(conn *clientConn, who, room string) bool {
+	if room != "" && s.roomMuted(conn, who, room) {
+		return false
+	}
+	muted, err := s.redis.MutedFor(who)
+	if err != nil {
+		s.logger.Error("Mute check failed", "error", err)
+	}
+	if muted > 0 {
+		conn.fail("muted", "RATE_LIMITED", retryAfter(muted))
+		return false
+	}
+	if !s.take(conn, who, "user:"+who, s.limits.user) {
+		return false
+	}
+	return room == "" || s.take(conn, who, "room:"+room, s.limits.room)
+}
+
+// take charges one token and replies ERR RATE_LIMITED when the bucket is
+// empty, muting who once it keeps happening. Redis errors fail open so an
+// outage does not take chat down with it.
+func (s *Server) take(conn *clientConn, who, key string, b bucket) bool {
+	ok, wait, err := s.redis.TakeToken(key, b.rate, b.burst)
+	if err != nil {
+		s.logger.Error("Rate limit check failed", "error", err)
+		return true
+	}
+	if ok {
+		return true
+	}
+
+	strikes, err := s.redis.AddStrike(who, s.limits.strikeWindow)
+	if err == nil && strikes >= s.limits.strikes {
+		if err := s.redis.AutoMute(who, s.limits.muteFor); err == nil {
+			s.logger.Warn("Auto-muted for flooding", "who", who, "for", s.limits.muteFor)
+			conn.fail("muted", "RATE_LIMITED", retryAfter(s.limits.muteFor))
+			return false
+		}
+	}
+	conn.fail("", "RATE_LIMITED", retryAfter(wait))
+	return false
+}
+
+// retryAfter renders "retry_after=<seconds>", rounded up.
+func retryAfter(d time.Duration) string {
+	return fmt.Sprintf("retry_after=%d", int(math.Ceil(d.Seconds())))
+}
+
+// limitName is who strikes and mutes count against: the user, or the
+// connection itself before login.
+func limitName(user *factory.User, sessionID string) string {
+	if user == nil {
+		return "anon:" + sessionID
+	}
+	return user.Name
+}
@@ -3,11 +3,11 @@ package server
 import (
 	"encoding/json"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"termchat/db/postgres"
 	"termchat/db/redis"
+	"termchat/pkg/mailer"
 	"termchat/pkg/message"
 	"termchat/pkg/users"
 
@@ -23,6 +23,8 @@ type Server struct {
 	user    users.Repository
 	message message.Repository
 	clients map[*websocket.Conn]bool
+	limits  rateLimits
+	mailer  mailer.Mailer
 }
 
 type ResponseMsg struct {
@@ -35,31 +37,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func Run(env *string) {
-	viper.SetConfigFile("json")
-
-	var level slog.Level
-	switch *env {
-	case "dev":
-		viper.SetConfigName("term_chat_dev")
-		level = slog.LevelDebug
-	case "prod":
-		viper.SetConfigName("term_chat_prod")
-		level = slog.LevelInfo
-	default:
-		viper.SetConfigName("term_chat_staging")
-		level = slog.LevelDebug
-	}
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("TERMCHAT") // Optional: allow TERMCHAT_POSTGRES_URL
-	viper.AddConfigPath(".")
-	err := viper.ReadInConfig()
-	if err != nil {
-		slog.Warn("No config file found, relying on environment variables", "error", err)
-
-	}
-
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
-	slog.SetDefault(logger)
+	logger := loadConfig(env)
 
 	postgres, err := postgres.NewPostgres()
 	if err != nil {
@@ -75,6 +53,8 @@ func Run(env *string) {
 		user:    postgres,
 		message: postgres,
 		clients: make(map[*websocket.Conn]bool),
+		limits:  loadRateLimits(),
+		mailer:  mailer.FromConfig(),
 	}
 
 	server.RegisterRoutes()
@@ -95,6 +75,11 @@ func Run(env *string) {
 		}
 	}()
 
+	// Start SSH server
+	if port := viper.GetString("ssh_port"); port != "" {
+		go StartSSHServer(port, server)
+	}
+
 	// Start TCP server
 	StartTCPServer("9000", server)
 }
@@ -122,12 +107,16 @@ func (s *Server) respond(w http.ResponseWriter, data interface{}, status int, er
 }
 
 func StartTCPServer(port string, srv *Server) {
-	listener, err := net.Listen("tcp", ":"+port)
+	listener, err := tcpListener(port)
 	if err != nil {
 		srv.logger.Error("TCP listener failed", "error", err)
 		return
 	}
-	srv.logger.Info("TCP server listening", "port", port)
+	useTLS := viper.GetString("tls_cert") != ""
+	if !useTLS {
+		srv.logger.Warn("TCP server is running WITHOUT TLS, passwords cross the network in cleartext")
+	}
+	srv.logger.Info("TCP server listening", "port", port, "tls", useTLS)
 
 	for {
 		conn, err := listener.Accept()
@@ -155,3 +144,59 @@ func enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// loadConfig reads the config file for env and installs the default logger.
+func loadConfig(env *string) *slog.Logger {
+	viper.SetConfigFile("json")
+
+	var level slog.Level
+	switch *env {
+	case "dev":
+		viper.SetConfigName("term_chat_dev")
+		level = slog.LevelDebug
+	case "prod":
+		viper.SetConfigName("term_chat_prod")
+		level = slog.LevelInfo
+	default:
+		viper.SetConfigName("term_chat_staging")
+		level = slog.LevelDebug
+	}
+	viper.AutomaticEnv()
+	viper.SetEnvPrefix("TERMCHAT") // Optional: allow TERMCHAT_POSTGRES_URL
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		slog.Warn("No config file found, relying on environment variables", "error", err)
+
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// SetAdmin grants (or with admin false, revokes) the server admin flag.
+func SetAdmin(env *string, email string, admin bool) error {
+	loadConfig(env)
+	postgres, err := postgres.NewPostgres()
+	if err != nil {
+		return err
+	}
+	if err := postgres.SetServerAdmin(email, admin); err != nil {
+		return err
+	}
+	slog.Info("Updated server admin", "email", email, "admin", admin)
+	return nil
+}
+
+// Reindex rebuilds the /find search index from stored message history.
+func Reindex(env *string) error {
+	loadConfig(env)
+	postgres, err := postgres.NewPostgres()
+	if err != nil {
+		return err
+	}
+	count, err := postgres.ReindexMessages()
+	slog.Info("Reindexed messages", "count", count)
+	return err
+}
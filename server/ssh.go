@@ -0,0 +1,341 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"termchat/client"
+	"termchat/factory"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/creack/pty"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+)
+
+// errSSHAuth is returned for every failed SSH login so the reply does not
+// reveal whether the user exists
+var errSSHAuth = errors.New("authentication failed")
+
+// ptyRequest is the payload of an SSH "pty-req" (RFC 4254 §6.2)
+type ptyRequest struct {
+	Term   string
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+	Modes  string
+}
+
+// windowChange is the payload of an SSH "window-change" (RFC 4254 §6.7)
+type windowChange struct {
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+}
+
+// StartSSHServer serves the TUI over SSH, so `ssh <user>@host` works
+// without installing the client. Users log in with their TermChat username
+// and password, or with a key registered via /sshkey.
+func StartSSHServer(port string, srv *Server) {
+	hostKey, err := loadHostKey(viper.GetString("ssh_host_key"))
+	if err != nil {
+		srv.logger.Error("SSH host key failed", "error", err)
+		return
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			ip := remoteIP(c.RemoteAddr())
+			// Unknown usernames still count against the IP
+			u, err := srv.user.GetUserByUsername(c.User())
+			if err != nil {
+				srv.loginFailed("ssh:"+c.User(), ip)
+				return nil, errSSHAuth
+			}
+			if srv.loginBlockedFor(u.Email, ip) > 0 {
+				return nil, errSSHAuth
+			}
+			if _, err := srv.user.Login(factory.User{Email: u.Email, Password: string(password)}); err != nil {
+				srv.loginFailed(u.Email, ip)
+				return nil, errSSHAuth
+			}
+			srv.loginSucceeded(u.Email)
+			if ban, err := srv.user.GetActiveBan(int(u.ID)); err != nil || ban != nil {
+				return nil, errSSHAuth
+			}
+			return sshPermissions(u), nil
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			ok, err := srv.user.HasSSHKey(c.User(), ssh.FingerprintSHA256(key))
+			if err != nil || !ok {
+				return nil, errSSHAuth
+			}
+			u, err := srv.user.GetUserByUsername(c.User())
+			if err != nil {
+				return nil, errSSHAuth
+			}
+			if ban, err := srv.user.GetActiveBan(int(u.ID)); err != nil || ban != nil {
+				return nil, errSSHAuth
+			}
+			return sshPermissions(u), nil
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	useHostedColorProfile()
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		srv.logger.Error("SSH listener failed", "error", err)
+		return
+	}
+	srv.logger.Info("SSH server listening", "port", port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			srv.logger.Error("Failed to accept SSH connection", "error", err)
+			continue
+		}
+		go srv.handleSSHConn(conn, cfg)
+	}
+}
+
+// hostedProfile guards the one-time colour profile switch for TUIs the
+// server hosts itself (SSH and the web terminal).
+var hostedProfile sync.Once
+
+// useHostedColorProfile picks one colour profile for every hosted TUI.
+// Styles are package globals in client, so this cannot be per terminal, and
+// probing the server's own stdout would say nothing about the user's.
+func useHostedColorProfile() {
+	hostedProfile.Do(func() { lipgloss.SetColorProfile(termenv.ANSI256) })
+}
+
+func sshPermissions(u factory.User) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{"email": u.Email}}
+}
+
+// loadHostKey reads the server's SSH host key, generating and saving an
+// ed25519 key on first start.
+func loadHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		path = "termchat_host_key"
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate host key: %w", err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "termchat host key")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode host key: %w", err)
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to save host key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+func (s *Server) handleSSHConn(nConn net.Conn, cfg *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(nConn, cfg)
+	if err != nil {
+		s.logger.Debug("SSH handshake failed", "remote", nConn.RemoteAddr().String(), "error", err)
+		return
+	}
+	defer sconn.Close()
+	s.logger.Info("SSH login", "user", sconn.User(), "remote", sconn.RemoteAddr().String())
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.logger.Error("SSH channel accept failed", "error", err)
+			continue
+		}
+		go s.handleSSHSession(sconn.Permissions.Extensions["email"], sconn.RemoteAddr(), channel, requests)
+	}
+}
+
+// handleSSHSession waits for a PTY and a shell, then runs the TUI on that
+// PTY until the user quits or the connection drops.
+func (s *Server) handleSSHSession(email string, remote net.Addr, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	var ptmx, tty *os.File
+	var program *tea.Program
+	defer func() {
+		if tty != nil {
+			tty.Close()
+			ptmx.Close()
+		}
+	}()
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			var p ptyRequest
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil || ptmx != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			var err error
+			ptmx, tty, err = pty.Open()
+			if err != nil {
+				s.logger.Error("PTY open failed", "error", err)
+				req.Reply(false, nil)
+				continue
+			}
+			pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(p.Rows), Cols: uint16(p.Cols)})
+			go io.Copy(ptmx, channel)
+			go io.Copy(channel, ptmx)
+			req.Reply(true, nil)
+
+		case "window-change":
+			var w windowChange
+			if err := ssh.Unmarshal(req.Payload, &w); err != nil || ptmx == nil {
+				continue
+			}
+			pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(w.Rows), Cols: uint16(w.Cols)})
+			if program != nil {
+				program.Send(tea.WindowSizeMsg{Width: int(w.Cols), Height: int(w.Rows)})
+			}
+
+		case "shell":
+			if ptmx == nil || program != nil {
+				req.Reply(false, nil)
+				if ptmx == nil {
+					io.WriteString(channel.Stderr(), "TermChat needs a terminal, connect with ssh -t\r\n")
+					return
+				}
+				continue
+			}
+			req.Reply(true, nil)
+
+			token, err := s.redis.GenerateToken(email)
+			if err == nil {
+				err = s.redis.StoreSession(email, token)
+			}
+			if err != nil {
+				s.logger.Error("SSH session token failed", "error", err)
+				return
+			}
+			// Remember the backend connection so it can be closed with the TUI
+			backend := make(chan net.Conn, 1)
+			dial := func() (net.Conn, error) {
+				conn, err := s.dialLocal(remote)
+				if err == nil {
+					backend <- conn
+				}
+				return conn, err
+			}
+			program = tea.NewProgram(
+				client.NewSessionModel(dial, token, tty),
+				tea.WithInput(tty),
+				tea.WithOutput(tty),
+				tea.WithAltScreen(),
+				tea.WithMouseCellMotion(),
+			)
+			go func() {
+				if _, err := program.Run(); err != nil {
+					s.logger.Error("SSH TUI failed", "error", err)
+				}
+				select {
+				case conn := <-backend:
+					conn.Close()
+				default:
+				}
+				// Revoke the session so the token dies with the connection
+				_ = s.redis.DeleteSession(email, token)
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				channel.Close()
+			}()
+
+		default:
+			// exec, subsystem, env… are not supported
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+	if program != nil {
+		program.Quit()
+	}
+}
+
+// hostedConn is the backend side of a dialLocal pair. It reports the hosted
+// user's real address instead of loopback, so per-IP throttles and lockouts
+// apply to them and not to every SSH or web user at once.
+type hostedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c hostedConn) RemoteAddr() net.Addr { return c.remote }
+
+// hosted reports whether the client is a TUI the server runs itself, so
+// anything it writes to disk would land on the server.
+func (c *clientConn) hosted() bool {
+	_, ok := c.Conn.(hostedConn)
+	return ok
+}
+
+// dialLocal connects an in-process TUI to the chat backend on behalf of the
+// user at remote. A loopback TCP pair is used instead of net.Pipe because
+// both ends write before they read (welcome banner vs. HELLO), which would
+// deadlock an unbuffered pipe.
+func (s *Server) dialLocal(remote net.Addr) (net.Conn, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	serverConn, ok := <-accepted
+	if !ok || serverConn.RemoteAddr().String() != conn.LocalAddr().String() {
+		// Someone else raced us to the port
+		conn.Close()
+		if ok {
+			serverConn.Close()
+		}
+		return nil, fmt.Errorf("failed to connect to chat backend")
+	}
+	if remote == nil {
+		remote = serverConn.RemoteAddr()
+	}
+	go handleTelnetClient(hostedConn{Conn: serverConn, remote: remote}, s)
+	return conn, nil
+}
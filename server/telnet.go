@@ -3,13 +3,21 @@ package server
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"termchat/factory"
+	msgpkg "termchat/pkg/message"
+	"termchat/pkg/protocol"
 	"termchat/pkg/users"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // notifyChannel returns the per-user Redis channel for incoming notifications.
@@ -17,8 +25,24 @@ func notifyChannel(username string) string {
 	return fmt.Sprintf("notify:%s", strings.ToLower(strings.TrimSpace(username)))
 }
 
-func handleTelnetClient(conn net.Conn, srv *Server) {
-	defer conn.Close()
+// revokeChannel carries the one session token of a user that survives a
+// password change; every other live session of theirs disconnects.
+func revokeChannel(email string) string {
+	return fmt.Sprintf("revoke:%s", strings.ToLower(strings.TrimSpace(email)))
+}
+
+// revokeSessions ends all sessions of email except keep (may be empty),
+// including connections that are logged in right now.
+func (s *Server) revokeSessions(email, keep string) {
+	if err := s.redis.DeleteOtherSessions(email, keep); err != nil {
+		s.logger.Error("Failed to delete sessions", "error", err)
+	}
+	_ = s.redis.Client.Publish(context.Background(), revokeChannel(email), keep).Err()
+}
+
+func handleTelnetClient(netConn net.Conn, srv *Server) {
+	defer netConn.Close()
+	conn := newClientConn(netConn)
 
 	// Unique session ID for this connection.
 	// Embedded in every published message so the publisher can ignore
@@ -26,8 +50,8 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 	// Use remote address + connection time as unique session ID (no extra deps needed)
 	sessionID := fmt.Sprintf("%s-%d", conn.RemoteAddr().String(), time.Now().UnixNano())
 
-	conn.Write([]byte("Welcome to TermChat CLI over Telnet!\n"))
-	conn.Write([]byte("Commands: /register <email> <username> <password>, /login <email> <password>, /chat <user>, /tempchat <user>, /send <user> <message>, /room, /search <prefix>, /create <name>, /join <name>, /leave <name>, /group <name>, /global, /kick <group> <user>, /invite <group> <user>, /exit\n"))
+	conn.text("Welcome to TermChat CLI over Telnet!\n")
+	conn.text("Commands: /register <email> <username> <password>, /login <email> <password>, /resume <token>, /logout, /passwd <old> <new>, /account delete|export, /forgot <email>, /reset <code> <new>, /sshkey add|list|remove, /chat <user>, /tempchat <user>, /send <user> <message>, /room, /who, /search <prefix>, /find <query> [in <chat>], /create <name>, /join <name>, /invitecode <group> [uses] [ttl], /invitecodes <group>, /revokecode <group> <code>, /redeem <code>, /requests <group>, /approve <group> <user>, /deny <group> <user>, /visibility <group> <public|private|invite_only>, /leave <name>, /group <name>, /global, /kick <group> <user>, /invite <group> <user>, /transfer <group> <user>, /promote <group> <user> <role>, /demote <group> <user> [role], /ban <user> [duration] [reason], /unban <user>, /mute <user> <room> [duration], /unmute <user> <room>, /announce <text>, /purge <user>, /exit\n")
 
 	reader := bufio.NewReader(conn)
 	var currentUser *factory.User
@@ -41,8 +65,82 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 	}
 	defer stopNotify()
 
+	// Presence heartbeat for this session of the logged in user; stopping it
+	// drops the session (the user goes offline with their last one) and
+	// stamps last_login as their last seen time
+	var presenceCancel context.CancelFunc
+	stopPresence := func() {
+		if presenceCancel != nil {
+			presenceCancel()
+			presenceCancel = nil
+			_ = srv.redis.ClearPresence(currentUser.Name, sessionID)
+			_ = srv.user.UpdateLastLogin(int(currentUser.ID))
+		}
+	}
+	defer stopPresence()
+
+	// startSession switches the connection to user after /login or /resume;
+	// token is the session that /logout revokes
+	var sessionToken string
+	startSession := func(user factory.User, token string) {
+		stopPresence()
+		currentUser, sessionToken = &user, token
+		conn.ok("LOGIN", currentUser.Name, token)
+
+		if err := srv.user.UpdateLastLogin(int(currentUser.ID)); err != nil {
+			srv.logger.Error("Failed to update last login", "error", err)
+		}
+		{
+			pCtx, pCancel := context.WithCancel(context.Background())
+			presenceCancel = pCancel
+			go srv.trackPresence(pCtx, conn, currentUser.Name, sessionID)
+		}
+
+		// Start per-user notification listener
+		stopNotify()
+		{
+			myName, myEmail := currentUser.Name, currentUser.Email
+			nCtx, nCancel := context.WithCancel(context.Background())
+			notifyCancel = nCancel
+			go func() {
+				ch := notifyChannel(myName)
+				ps := srv.redis.Client.Subscribe(nCtx, ch, announceChannel, revokeChannel(myEmail))
+				defer ps.Close()
+				mc := ps.Channel()
+				for {
+					select {
+					case <-nCtx.Done():
+						return
+					case msg, ok := <-mc:
+						if !ok {
+							return
+						}
+						if msg.Channel != ch && msg.Channel != announceChannel {
+							// Password changed elsewhere: only the session that did it survives
+							if msg.Payload != token {
+								conn.fail("", "AUTH", "session_revoked")
+								conn.Close()
+								return
+							}
+							continue
+						}
+						// Payload is a V2 frame, e.g. {"verb":"NOTIFY","words":["CHAT"],"fields":["alice"]}
+						f, err := protocol.Decode(msg.Payload)
+						if err != nil {
+							continue
+						}
+						conn.send(f)
+					}
+				}
+			}()
+		}
+	}
+
+	// Account deletion waiting for /account delete confirm
+	var pendingDel *pendingDelete
+
 	for {
-		conn.Write([]byte("> "))
+		conn.prompt()
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			srv.logger.Error("Client disconnected", "error", err)
@@ -60,15 +158,27 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 		if len(args) > 1 {
 			argLine = args[1]
 		}
+		if cmd != "/exit" && !srv.allowLine(conn, limitName(currentUser, sessionID), sessionID) {
+			continue
+		}
 
 		switch cmd {
 
+		// =====================================================
+		// HELLO — protocol version & capability negotiation
+		//
+		//   → HELLO <version> <caps...>
+		//   ← HELLO <version> <agreed caps...>   (already in the new framing)
+		// =====================================================
+		case "HELLO":
+			conn.hello(argLine)
+
 		// =====================================================
 		// EXIT
 		// =====================================================
 		case "/exit":
 			stopNotify()
-			conn.Write([]byte("OK EXIT\n"))
+			conn.ok("EXIT")
 			return
 
 		// =====================================================
@@ -77,13 +187,27 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 		case "/register":
 			parts := strings.Fields(argLine)
 			if len(parts) != 3 {
-				conn.Write([]byte("ERR REGISTER invalid_arguments\n"))
+				conn.fail("", "REGISTER", "invalid_arguments")
+				continue
+			}
+			if ok, wait := srv.allowRegister(remoteIP(conn.RemoteAddr())); !ok {
+				conn.fail("", "REGISTER", "too_many_attempts", retryAfter(wait))
 				continue
 			}
 			email, username, password := parts[0], parts[1], parts[2]
+			if strings.HasPrefix(username, "deleted-") {
+				// Reserved for anonymized accounts
+				conn.fail("", "REGISTER", "invalid_username")
+				continue
+			}
+			if strings.HasSuffix(strings.ToLower(email), "@invalid") {
+				// Placeholder address of anonymized accounts
+				conn.fail("", "REGISTER", "invalid_email")
+				continue
+			}
 			hashed, err := users.HashPassword(password)
 			if err != nil {
-				conn.Write([]byte("ERR REGISTER hash_failed\n"))
+				conn.fail("", "REGISTER", "hash_failed")
 				continue
 			}
 			user := factory.User{
@@ -92,83 +216,350 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 				HashedPassword: hashed,
 			}
 			if err := srv.user.CreateUser(user); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR REGISTER %s\n", err)))
+				// Never say which field clashed, or /register becomes a way
+				// to probe for accounts
+				srv.logger.Info("Registration failed", "error", err)
+				conn.fail("", "REGISTER", "registration_failed")
 			} else {
-				conn.Write([]byte("OK REGISTER\n"))
+				conn.ok("REGISTER")
 			}
 
 		// =====================================================
 		// LOGIN
+		//
+		//   → /login <email> <password>
+		//   ← OK LOGIN <user> <token>
 		// =====================================================
 		case "/login":
 			parts := strings.Fields(argLine)
 			if len(parts) != 2 {
-				conn.Write([]byte("ERR LOGIN invalid_arguments\n"))
+				conn.fail("", "LOGIN", "invalid_arguments")
 				continue
 			}
 			email, password := parts[0], parts[1]
+			ip := remoteIP(conn.RemoteAddr())
+			if wait := srv.loginBlockedFor(email, ip); wait > 0 {
+				conn.fail("", "LOGIN", "too_many_attempts", retryAfter(wait))
+				continue
+			}
 			user := factory.User{Email: email, Password: password}
 			loggedInUser, err := srv.user.Login(user)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR LOGIN %s\n", err)))
+				if !errors.Is(err, users.ErrInvalidCredentials) {
+					srv.logger.Error("Login failed", "error", err)
+				}
+				srv.loginFailed(email, ip)
+				conn.fail("", "LOGIN", "invalid_credentials")
+				continue
+			}
+			srv.loginSucceeded(email)
+			if srv.banned(conn, "LOGIN", int(loggedInUser.ID)) {
+				continue
+			}
+			token, err := srv.redis.GenerateToken(loggedInUser.Email)
+			if err == nil {
+				err = srv.redis.StoreSession(loggedInUser.Email, token)
+			}
+			if err != nil {
+				conn.fail(err.Error(), "LOGIN", "session_failed")
+				continue
+			}
+			startSession(loggedInUser, token)
+
+		// =====================================================
+		// RESUME — log back in with the token from OK LOGIN
+		//
+		//   → /resume <token>
+		//   ← OK LOGIN <user> <token>
+		// =====================================================
+		case "/resume":
+			token := strings.TrimSpace(argLine)
+			if token == "" {
+				conn.fail("", "RESUME", "invalid_arguments")
+				continue
+			}
+			email, err := srv.redis.ResumeSession(token)
+			if err != nil {
+				conn.fail(err.Error(), "RESUME", "invalid_session")
+				continue
+			}
+			user, err := srv.user.GetUser(email)
+			if err != nil {
+				conn.fail(err.Error(), "RESUME", "invalid_session")
+				continue
+			}
+			if srv.banned(conn, "RESUME", int(user.ID)) {
 				continue
 			}
-			currentUser = &loggedInUser
-			conn.Write([]byte(fmt.Sprintf("OK LOGIN %s\n", currentUser.Name)))
+			startSession(user, token)
 
-			// Start per-user notification listener
+		// =====================================================
+		// LOGOUT — ends this session and revokes its token
+		// =====================================================
+		case "/logout":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			if err := srv.redis.DeleteSession(currentUser.Email, sessionToken); err != nil {
+				srv.logger.Error("Failed to delete session", "error", err)
+			}
 			stopNotify()
-			{
-				myName := currentUser.Name
-				nCtx, nCancel := context.WithCancel(context.Background())
-				notifyCancel = nCancel
-				go func() {
-					ch := notifyChannel(myName)
-					ps := srv.redis.Client.Subscribe(nCtx, ch)
-					defer ps.Close()
-					mc := ps.Channel()
-					for {
-						select {
-						case <-nCtx.Done():
-							return
-						case msg, ok := <-mc:
-							if !ok {
-								return
-							}
-							conn.Write([]byte("NOTIFY " + msg.Payload + "\n"))
-						}
+			stopPresence()
+			currentUser, sessionToken = nil, ""
+			conn.ok("LOGOUT")
+
+		// =====================================================
+		// PASSWD — change the password; other sessions are logged out
+		//
+		//   → /passwd <old> <new>
+		//   ← OK PASSWD
+		// =====================================================
+		case "/passwd":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", "PASSWD", "invalid_arguments")
+				continue
+			}
+			ip := remoteIP(conn.RemoteAddr())
+			if wait := srv.loginBlockedFor(currentUser.Email, ip); wait > 0 {
+				conn.fail("", "PASSWD", "too_many_attempts", retryAfter(wait))
+				continue
+			}
+			if _, err := srv.user.Login(factory.User{Email: currentUser.Email, Password: parts[0]}); err != nil {
+				srv.loginFailed(currentUser.Email, ip)
+				conn.fail("", "PASSWD", "invalid_credentials")
+				continue
+			}
+			if err := srv.setPassword(currentUser.Email, parts[1], sessionToken); err != nil {
+				conn.fail(err.Error(), "PASSWD")
+				continue
+			}
+			conn.ok("PASSWD")
+
+		// =====================================================
+		// ACCOUNT — delete the account or export its data
+		//
+		//   → /account delete anonymize|purge
+		//   ← OK ACCOUNT CONFIRM <code>
+		//   → /account delete confirm <code>
+		//   ← OK ACCOUNT DELETED
+		//   → /account export
+		//   ← OK EXPORT <filename>, EXPORT <base64>..., OK EXPORT END <bytes>
+		//   ← ERR ACCOUNT export_unavailable   (SSH and web sessions)
+		// =====================================================
+		case "/account":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			switch {
+			case len(parts) == 1 && parts[0] == "export":
+				if conn.hosted() {
+					// The file would be written on the server, not for the user
+					conn.fail("", "ACCOUNT", "export_unavailable")
+					continue
+				}
+				if err := srv.sendExport(conn, currentUser); err != nil {
+					conn.fail(err.Error(), "EXPORT")
+				}
+			case len(parts) == 2 && parts[0] == "delete" && (parts[1] == "anonymize" || parts[1] == "purge"):
+				pending, err := newPendingDelete(parts[1] == "purge")
+				if err != nil {
+					conn.fail(err.Error(), "ACCOUNT")
+					continue
+				}
+				pendingDel = pending
+				conn.ok("ACCOUNT", "CONFIRM", pending.code)
+			case len(parts) == 3 && parts[0] == "delete" && parts[1] == "confirm":
+				if !pendingDel.matches(parts[2]) {
+					conn.fail("", "ACCOUNT", "invalid_code")
+					continue
+				}
+				purge := pendingDel.purge
+				pendingDel = nil
+				stopNotify()
+				stopPresence()
+				if err := srv.deleteAccount(currentUser, purge); err != nil {
+					conn.fail(err.Error(), "ACCOUNT")
+					// Nothing was deleted, carry on with the same session
+					startSession(*currentUser, sessionToken)
+					continue
+				}
+				currentUser, sessionToken = nil, ""
+				conn.ok("ACCOUNT", "DELETED")
+			default:
+				conn.fail("", "ACCOUNT", "invalid_arguments")
+			}
+
+		// =====================================================
+		// FORGOT / RESET — password reset by mailed code
+		//
+		//   → /forgot <email>
+		//   ← OK FORGOT            (whether or not the account exists)
+		//   → /reset <code> <new password>
+		//   ← OK RESET
+		// =====================================================
+		case "/forgot":
+			email := strings.TrimSpace(argLine)
+			if email == "" {
+				conn.fail("", "FORGOT", "invalid_arguments")
+				continue
+			}
+			// In the background, so the reply time does not give the answer away either
+			go srv.sendResetCode(email, remoteIP(conn.RemoteAddr()))
+			conn.ok("FORGOT")
+
+		case "/reset":
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", "RESET", "invalid_arguments")
+				continue
+			}
+			email, err := srv.redis.GetEmailFromHash(parts[0])
+			if err != nil {
+				conn.fail("", "RESET", "invalid_code")
+				continue
+			}
+			if err := srv.setPassword(email, parts[1], ""); err != nil {
+				conn.fail(err.Error(), "RESET")
+				continue
+			}
+			srv.loginSucceeded(email)
+			conn.ok("RESET")
+
+		// =====================================================
+		// SSH KEYS — public keys for logging in over SSH
+		//
+		//   → /sshkey add <authorized_keys line>
+		//   ← OK SSHKEY ADDED <fingerprint>
+		//   → /sshkey list
+		//   ← SSHKEY <fingerprint> <comment>   (or SSHKEY NONE)
+		//   → /sshkey remove <fingerprint>
+		//   ← OK SSHKEY REMOVED <fingerprint>
+		// =====================================================
+		case "/sshkey":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			sub, rest, _ := strings.Cut(strings.TrimSpace(argLine), " ")
+			rest = strings.TrimSpace(rest)
+			switch sub {
+			case "add":
+				key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+				if err != nil {
+					conn.fail("", "SSHKEY", "invalid_key")
+					continue
+				}
+				line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+				if comment != "" {
+					line += " " + comment
+				}
+				fingerprint := ssh.FingerprintSHA256(key)
+				if err := srv.user.AddSSHKey(int(currentUser.ID), fingerprint, line); err != nil {
+					conn.fail(err.Error(), "SSHKEY")
+					continue
+				}
+				conn.ok("SSHKEY", "ADDED", fingerprint)
+			case "list":
+				keys, err := srv.user.GetSSHKeys(int(currentUser.ID))
+				if err != nil {
+					conn.fail(err.Error(), "SSHKEY")
+					continue
+				}
+				if len(keys) == 0 {
+					conn.send(protocol.NewFrame("SSHKEY", "NONE"))
+					continue
+				}
+				for _, k := range keys {
+					comment := ""
+					if f := strings.Fields(k.PublicKey); len(f) > 2 {
+						comment = strings.Join(f[2:], " ")
 					}
-				}()
+					conn.send(protocol.NewFrame("SSHKEY", k.Fingerprint, comment))
+				}
+			case "remove":
+				if err := srv.user.DeleteSSHKey(int(currentUser.ID), rest); err != nil {
+					conn.fail(err.Error(), "SSHKEY")
+					continue
+				}
+				conn.ok("SSHKEY", "REMOVED", rest)
+			default:
+				conn.fail("", "SSHKEY", "invalid_arguments")
 			}
 
 		// =====================================================
-		// ROOM LIST
+		// ROOM LIST — most recently active first
+		//
+		//   ← ROOM @<partner> <unread>|<last_at>|<last_sender>|<preview>|<presence>|<last_seen>
+		//   ← ROOM <group> <unread>|<last_at>|<last_sender>|<preview>
+		//   ← ROOM NONE
 		// =====================================================
 		case "/room":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
-			partners, err := srv.message.GetChatPartners(int(currentUser.ID))
+			rooms, err := srv.message.GetRoomSummaries(int(currentUser.ID))
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR ROOM partners_failed %s\n", err)))
+				conn.fail(err.Error(), "ROOM", "rooms_failed")
 				continue
 			}
-			groups, err := srv.message.GetUserGroupChats(int(currentUser.ID))
-			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR ROOM groups_failed %s\n", err)))
+
+			if len(rooms) == 0 {
+				conn.send(protocol.NewFrame("ROOM", "NONE"))
 				continue
 			}
+			var partners []string
+			for _, r := range rooms {
+				if r.ChatType == "personal" {
+					partners = append(partners, r.Name)
+				}
+			}
+			presence := srv.presenceOf(partners...)
+			for _, r := range rooms {
+				name := r.Name
+				fields := []string{strconv.Itoa(r.Unread), r.LastAt, r.LastSender, msgpkg.Preview(r.Preview, 40)}
+				if r.ChatType == "personal" {
+					name = "@" + r.Name
+					fields = append(fields, presence[r.Name], r.LastSeen)
+				}
+				conn.send(protocol.NewFrame("ROOM", name).With(fields...))
+			}
 
-			if len(partners) == 0 && len(groups) == 0 {
-				conn.Write([]byte("ROOM NONE\n"))
+		// =====================================================
+		// WHO — users connected right now
+		//
+		//   ← WHO <user> <online|away>
+		//   ← WHO NONE
+		// =====================================================
+		case "/who":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			online, err := srv.redis.OnlineUsers()
+			if err != nil {
+				conn.fail(err.Error(), "WHO")
+				continue
+			}
+			if len(online) == 0 {
+				conn.send(protocol.NewFrame("WHO", "NONE"))
 				continue
 			}
-			for _, name := range partners {
-				conn.Write([]byte(fmt.Sprintf("ROOM @%s\n", name)))
+			names := make([]string, 0, len(online))
+			for name := range online {
+				names = append(names, name)
 			}
-			for _, g := range groups {
-				conn.Write([]byte(fmt.Sprintf("ROOM %s\n", g.Name)))
+			sort.Strings(names)
+			for _, name := range names {
+				conn.send(protocol.NewFrame("WHO", name, online[name]))
 			}
 
 		// =====================================================
@@ -176,77 +567,84 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 		// =====================================================
 		case "/send":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			parts := strings.SplitN(argLine, " ", 2)
 			if len(parts) != 2 {
-				conn.Write([]byte("ERR SEND invalid_arguments\n"))
+				conn.fail("", "SEND", "invalid_arguments")
 				continue
 			}
 			receiver, msg := parts[0], parts[1]
-			if err := srv.message.SendPersonalMessage(currentUser.Name, receiver, msg, ""); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR SEND %s\n", err)))
+			if !srv.allowSend(conn, currentUser.Name, "") {
+				continue
+			}
+			if id, err := srv.message.SendPersonalMessage(currentUser.Name, receiver, msg, 0, ""); err != nil {
+				conn.fail(err.Error(), "SEND")
 			} else {
-				payload := fmt.Sprintf("MSG %s", currentUser.Name)
-				_ = srv.redis.Client.Publish(context.Background(), notifyChannel(receiver), payload).Err()
-				conn.Write([]byte("OK SEND\n"))
-				// Optional: show a banner on receiver side
-				_ = srv.redis.Client.Publish(context.Background(), notifyChannel(receiver), fmt.Sprintf("MSG %s", currentUser.Name)).Err()
+				conn.ok("SEND", strconv.Itoa(id))
+				// Show a banner on receiver side
+				srv.publishNotify(receiver, protocol.NewFrame("NOTIFY", "MSG").With(currentUser.Name))
 			}
 
 		// =====================================================
 		// CHAT — persistent with history + live Redis
 		//
-		// Payload format (Redis): <sessionID>|<sender>|<timestamp>|<content>
+		// Payload format (Redis): factory.ChatEvent as JSON
 		// Client protocol:
-		//   ← OK CHAT <partner>
-		//   ← HIST <timestamp>|<sender>|<content>
+		//   ← OK CHAT <partner> <presence>|<last_seen>
+		//   ← HIST <id>|<timestamp>|<sender>|<content>|<reactions>|<flags>|<parent_id>|<read_by>
 		//   ← OK CHAT READY
-		//   ← MSG <sender>|<timestamp>|<content>    (live)
+		//   ← MSG <id>|<sender>|<timestamp>|<content>|<parent_id>   (live)
+		//   ← EDIT <id>|<sender>|<edited_at>|<content>   (live)
+		//   ← DELETE <id>|<deleted_by>                   (live)
+		//   ← REACTION <id>|<sender>|<emoji>             (live, "reactions" cap)
+		//   ← READ <id> <user>    (live, "receipts" cap: user has read up to id)
+		//   ← TYPING <user>       (live, "typing" cap, sent after → /typing)
+		//   ← OK SENT <id>                               (ack for our own message or /reply)
+		//   ← OK THREAD <root_id>, HIST..., OK THREAD READY   (answer to /thread)
+		//   ← OK MORE <before_id>, HIST..., OK MORE END <n>   (answer to /more)
 		//   ← OK CHAT EXIT
 		// =====================================================
 		case "/chat":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			chatPartner := strings.TrimSpace(argLine)
 			if chatPartner == "" {
-				conn.Write([]byte("ERR CHAT invalid_arguments\n"))
+				conn.fail("", "CHAT", "invalid_arguments")
 				continue
 			}
 
 			// Notify partner
-			_ = srv.redis.Client.Publish(
-				context.Background(),
-				notifyChannel(chatPartner),
-				fmt.Sprintf("CHAT %s", currentUser.Name),
-			).Err()
+			srv.publishNotify(chatPartner, protocol.NewFrame("NOTIFY", "CHAT").With(currentUser.Name))
 
-			conn.Write([]byte(fmt.Sprintf("OK CHAT %s\n", chatPartner)))
+			conn.send(partnerFrame(srv, "CHAT", chatPartner))
 
-			// History
-			messages, err := srv.message.GetMessagesBetweenUsers(currentUser.Name, chatPartner)
+			// History, latest page only; older pages come via /more
+			messages, err := srv.message.GetMessagesBetweenUsers(currentUser.Name, chatPartner, 0, historyPageSize)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR CHAT history_failed %s\n", err)))
+				conn.fail(err.Error(), "CHAT", "history_failed")
 				continue
 			}
 			for _, m := range messages {
-				reactionsStr := formatReactions(m.Reactions)
-				conn.Write([]byte(fmt.Sprintf("HIST %s|%s|%s|%s\n", m.SentAt, m.SenderName, m.Content, reactionsStr)))
+				conn.send(histFrame(m))
 			}
-			conn.Write([]byte("OK CHAT READY\n"))
+			conn.ok("CHAT", "READY")
 
 			chatID, err := srv.message.GetChatID(currentUser.Name, chatPartner)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR CHAT pubsub_failed %s\n", err)))
+				conn.fail(err.Error(), "CHAT", "pubsub_failed")
 				continue
 			}
 
-			channelName := fmt.Sprintf("chat:%d", chatID)
+			room := personalRoom(chatID, chatPartner)
+			if len(messages) > 0 {
+				srv.markRead(currentUser, room, messages[len(messages)-1].ID, sessionID)
+			}
 			ctx := context.Background()
-			pubsub := srv.redis.Client.Subscribe(ctx, channelName)
+			pubsub := srv.redis.Client.Subscribe(ctx, room.channel)
 			msgChan := pubsub.Channel()
 
 			done := make(chan struct{})
@@ -256,7 +654,6 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 			mySessionID := sessionID // capture for goroutine
 
 			// Goroutine: forward messages from OTHER sessions only.
-			// Payload: <sessionID>|<sender>|<timestamp>|<content>
 			go func() {
 				defer pubsub.Close()
 				for {
@@ -267,17 +664,10 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 						if !ok {
 							return
 						}
-						// Split into 4 parts: sessionID | sender | timestamp | content
-						segs := strings.SplitN(msg.Payload, "|", 4)
-						if len(segs) != 4 {
-							continue
-						}
-						fromSession, sender, ts, content := segs[0], segs[1], segs[2], segs[3]
-						// Skip our own session's messages (already echoed optimistically on client)
-						if fromSession == mySessionID {
-							continue
+						// The chat is open, so a live message counts as read
+						if ev, ok := forwardChatEvent(conn, msg.Payload, mySessionID); ok && ev.Type == "MSG" && ev.Sender != currentUser.Name {
+							srv.markRead(currentUser, room, ev.MessageID, mySessionID)
 						}
-						conn.Write([]byte(fmt.Sprintf("MSG %s|%s|%s\n", sender, ts, content)))
 					}
 				}
 			}()
@@ -304,53 +694,51 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 					safeClose()
 					break
 				}
+				if !srv.allowLine(conn, senderName, mySessionID) {
+					continue
+				}
 
-				if strings.HasPrefix(msgLine, "/react ") {
-					emoji := strings.TrimPrefix(msgLine, "/react ")
-					id, err := srv.message.GetLastMessageID("personal", chatID)
-					if err == nil {
-						srv.message.AddReaction(id, int(currentUser.ID), emoji)
-						payload := fmt.Sprintf("%s|%s|REACTION|%s", mySessionID, senderName, emoji)
-						_ = srv.redis.Client.Publish(ctx, channelName, payload).Err()
-					}
+				if handleChatCommand(conn, srv, currentUser, room, mySessionID, msgLine) {
 					continue
 				}
 
-				if err := srv.message.SendPersonalMessage(senderName, chatPartner, msgLine, mySessionID); err != nil {
-					conn.Write([]byte(fmt.Sprintf("ERR CHAT send_failed %s\n", err)))
+				if !srv.allowSend(conn, senderName, room.channel) {
 					continue
 				}
+				id, err := srv.message.SendPersonalMessage(senderName, chatPartner, msgLine, 0, mySessionID)
+				if err != nil {
+					conn.fail(err.Error(), "CHAT", "send_failed")
+					continue
+				}
+				conn.ok("SENT", strconv.Itoa(id))
 			}
 
 		ChatExit:
-			conn.Write([]byte("OK CHAT EXIT\n"))
+			conn.ok("CHAT", "EXIT")
 
 		// =====================================================
 		// TEMP CHAT — ephemeral, no DB save
 		//
 		// Payload format (Redis): <sessionID>|<sender>|<timestamp>|<content>
 		//                    or:  <sessionID>|<sender>|/close
+		//                    or:  <sessionID>|<sender>|/typing
 		// =====================================================
 		case "/tempchat":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			chatPartner := strings.TrimSpace(argLine)
 			if chatPartner == "" {
-				conn.Write([]byte("ERR TEMPCHAT invalid_arguments\n"))
+				conn.fail("", "TEMPCHAT", "invalid_arguments")
 				continue
 			}
 
 			// Notify partner
-			_ = srv.redis.Client.Publish(
-				context.Background(),
-				notifyChannel(chatPartner),
-				fmt.Sprintf("TEMPCHAT %s", currentUser.Name),
-			).Err()
+			srv.publishNotify(chatPartner, protocol.NewFrame("NOTIFY", "TEMPCHAT").With(currentUser.Name))
 
 			channelName := makeTempChatChannel(currentUser.Name, chatPartner)
-			conn.Write([]byte(fmt.Sprintf("OK TEMPCHAT %s\n", chatPartner)))
+			conn.send(partnerFrame(srv, "TEMPCHAT", chatPartner))
 
 			ctx := context.Background()
 			pubsub := srv.redis.Client.Subscribe(ctx, channelName)
@@ -372,19 +760,30 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 						if !ok {
 							return
 						}
-						// Payload: <sessionID>|<rest...>
-						firstPipe := strings.Index(msg.Payload, "|")
-						if firstPipe == -1 {
+						// Payload: <sessionID>|<sender>|<timestamp>|<content>
+						//     or:  <sessionID>|<sender>|/close
+						//     or:  <sessionID>|<sender>|/typing
+						segs := strings.SplitN(msg.Payload, "|", 4)
+						if len(segs) < 3 {
 							continue
 						}
-						fromSession := msg.Payload[:firstPipe]
-						rest := msg.Payload[firstPipe+1:]
 
 						// Skip our own session
-						if fromSession == mySessionID {
+						if segs[0] == mySessionID {
 							continue
 						}
-						conn.Write([]byte("MSG " + rest + "\n"))
+						if len(segs) == 3 && segs[2] == "/typing" {
+							if conn.has(protocol.CapTyping) {
+								conn.send(protocol.NewFrame("TYPING", segs[1]))
+							}
+							continue
+						}
+						if len(segs) == 3 {
+							conn.send(protocol.NewFrame("MSG").With(segs[1:]...))
+							continue
+						}
+						// Ephemeral messages have no ID
+						conn.send(protocol.NewFrame("MSG").With("", segs[1], segs[2], segs[3]))
 					}
 				}
 			}()
@@ -415,38 +814,106 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 					break
 				}
 
+				if !srv.allowLine(conn, senderName, mySessionID) {
+					continue
+				}
+
+				if msgLine == "/typing" {
+					payload := fmt.Sprintf("%s|%s|/typing", mySessionID, senderName)
+					_ = srv.redis.Client.Publish(ctx, channelName, payload).Err()
+					continue
+				}
+
+				if !srv.allowSend(conn, senderName, channelName) {
+					continue
+				}
+
 				ts := time.Now().Format("2006-01-02 15:04:05")
 				payload := fmt.Sprintf("%s|%s|%s|%s", mySessionID, senderName, ts, msgLine)
 				_ = srv.redis.Client.Publish(ctx, channelName, payload).Err()
 			}
 
 		TempExit:
-			conn.Write([]byte("OK TEMPCHAT EXIT\n"))
+			conn.ok("TEMPCHAT", "EXIT")
 
 		// =====================================================
 		// SEARCH
 		// =====================================================
 		case "/search":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			keyword := strings.TrimSpace(argLine)
 			if keyword == "" {
-				conn.Write([]byte("ERR SEARCH invalid_arguments\n"))
+				conn.fail("", "SEARCH", "invalid_arguments")
 				continue
 			}
 			usersFound, err := srv.user.SearchUsersByName(keyword)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR SEARCH %s\n", err)))
+				conn.fail(err.Error(), "SEARCH")
 				continue
 			}
 			if len(usersFound) == 0 {
-				conn.Write([]byte("SEARCH NONE\n"))
+				conn.send(protocol.NewFrame("SEARCH", "NONE"))
 				continue
 			}
+			names := make([]string, len(usersFound))
+			for i, u := range usersFound {
+				names[i] = u.Name
+			}
+			presence := srv.presenceOf(names...)
+			// SEARCH <user> <email> <presence>|<last_seen>
 			for _, u := range usersFound {
-				conn.Write([]byte(fmt.Sprintf("SEARCH %s %s\n", u.Name, u.Email)))
+				conn.send(protocol.NewFrame("SEARCH", u.Name, u.Email).With(presence[u.Name], u.LastLogin))
+			}
+
+		// =====================================================
+		// FIND — full-text search over the caller's conversations
+		//
+		//   → /find <query> [in @<user>|<group>]
+		//   ← FIND <chat> <id>|<ts>|<sender>|<content>
+		//   ← FIND NONE
+		// =====================================================
+		case "/find":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			// A trailing "in @<user>" or "in <group>" narrows the search only
+			// when it names a conversation; otherwise "in" is part of the query
+			query, chatType, chatID := argLine, "", 0
+			if i := strings.LastIndex(argLine, " in "); i >= 0 {
+				if scope := strings.TrimSpace(argLine[i+4:]); scope != "" && !strings.ContainsAny(scope, " \t") {
+					kind := "group"
+					var id int
+					var err error
+					if partner, ok := strings.CutPrefix(scope, "@"); ok {
+						kind = "personal"
+						id, err = srv.message.GetChatID(currentUser.Name, partner)
+					} else {
+						id, err = srv.message.GetGroupChatID(scope)
+					}
+					if err == nil {
+						query, chatType, chatID = strings.TrimSpace(argLine[:i]), kind, id
+					}
+				}
+			}
+			if query == "" {
+				conn.fail("", "FIND", "invalid_arguments")
+				continue
+			}
+			hits, err := srv.message.FindMessages(int(currentUser.ID), query, chatType, chatID, findLimit)
+			if err != nil {
+				conn.fail(err.Error(), "FIND")
+				continue
+			}
+			if len(hits) == 0 {
+				conn.send(protocol.NewFrame("FIND", "NONE"))
+				continue
+			}
+			for _, h := range hits {
+				conn.send(protocol.NewFrame("FIND", h.Chat).With(strconv.Itoa(h.ID), h.SentAt, h.SenderName, h.Content))
 			}
 
 		// =====================================================
@@ -454,7 +921,7 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 		// =====================================================
 		case "/create":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			parts := strings.SplitN(argLine, " ", 2)
@@ -464,143 +931,691 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 				desc = parts[1]
 			}
 			if name == "" {
-				conn.Write([]byte("ERR CREATE missing_name\n"))
+				conn.fail("", "CREATE", "missing_name")
 				continue
 			}
 			id, err := srv.message.CreateGroupChat(name, desc, int(currentUser.ID))
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR CREATE %s\n", err)))
+				conn.fail(err.Error(), "CREATE")
 			} else {
-				conn.Write([]byte(fmt.Sprintf("OK CREATE %s %d\n", name, id)))
+				conn.ok("CREATE", name, fmt.Sprint(id))
 				// Auto-enter
 				handleGroupChat(conn, srv, name, id, currentUser, sessionID, reader)
 			}
 
 		// =====================================================
-		// JOIN GROUP
+		// JOIN GROUP — public groups at once, private ones by request,
+		// invite-only ones (and private ones) with an /invite
+		//
+		//   → /join <name>
+		//   ← OK JOIN <name>
+		//   ← OK JOINREQ <name>          (private: waiting for approval)
+		//   ← ERR JOIN invite_only
 		// =====================================================
 		case "/join":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			name := strings.TrimSpace(argLine)
 			id, err := srv.message.GetGroupChatID(name)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR JOIN %s\n", err)))
+				conn.fail(err.Error(), "JOIN")
 				continue
 			}
-			if err := srv.message.JoinGroupChat(int(currentUser.ID), id); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR JOIN %s\n", err)))
-			} else {
-				conn.Write([]byte(fmt.Sprintf("OK JOIN %s\n", name)))
-			}
-
-		// =====================================================
-		// LEAVE GROUP
-		// =====================================================
-		case "/leave":
-			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+			group, err := srv.message.GetGroupChat(id)
+			if err != nil {
+				conn.fail(err.Error(), "JOIN")
 				continue
 			}
-			name := strings.TrimSpace(argLine)
-			id, err := srv.message.GetGroupChatID(name)
+			invited, err := srv.message.TakeGroupInvite(id, int(currentUser.ID))
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR LEAVE %s\n", err)))
+				conn.fail(err.Error(), "JOIN")
 				continue
 			}
-			if err := srv.message.LeaveGroupChat(int(currentUser.ID), id); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR LEAVE %s\n", err)))
-			} else {
-				conn.Write([]byte(fmt.Sprintf("OK LEAVE %s\n", name)))
+			member := srv.groupRole(int(currentUser.ID), id) != ""
+			switch {
+			case member || invited || group.Visibility == msgpkg.VisibilityPublic:
+				if err := srv.message.JoinGroupChat(int(currentUser.ID), id); err != nil {
+					conn.fail(err.Error(), "JOIN")
+					continue
+				}
+				conn.ok("JOIN", name)
+			case group.Visibility == msgpkg.VisibilityPrivate:
+				if err := srv.message.AddJoinRequest(id, int(currentUser.ID)); err != nil {
+					conn.fail(err.Error(), "JOIN")
+					continue
+				}
+				conn.ok("JOINREQ", name)
+				managers, _ := srv.message.GetGroupManagers(id)
+				for _, m := range managers {
+					srv.publishNotify(m, protocol.NewFrame("NOTIFY", "JOINREQ").With(currentUser.Name, name))
+				}
+			default:
+				conn.fail("", "JOIN", "invite_only")
 			}
 
 		// =====================================================
-		// KICK FROM GROUP (Owner only)
+		// INVITE CODES — shareable codes to join a group
+		//
+		//   → /invitecode <group> [uses] [ttl]    (uses 0: no limit)
+		//   ← OK INVITECODE <group> <code> <uses> <expires_at>
+		//   → /invitecodes <group>
+		//   ← INVITECODE <code> <uses_left>|<expires_at>|<created_by>   (or INVITECODE NONE)
+		//   → /revokecode <group> <code>
+		//   ← OK REVOKECODE <code>
+		//   → /redeem <code>
+		//   ← OK JOIN <group>
 		// =====================================================
-		case "/kick":
+		case "/invitecode":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			parts := strings.Fields(argLine)
-			if len(parts) != 2 {
-				conn.Write([]byte("ERR KICK invalid_arguments\n"))
+			if len(parts) < 1 || len(parts) > 3 {
+				conn.fail("", "INVITECODE", "invalid_arguments")
 				continue
 			}
-			groupName, targetUser := parts[0], parts[1]
-			groupID, err := srv.message.GetGroupChatID(groupName)
+			uses, ttl := inviteCodeUses, inviteCodeTTL
+			if len(parts) > 1 {
+				n, err := strconv.Atoi(parts[1])
+				if err != nil || n < 0 {
+					conn.fail("", "INVITECODE", "invalid_arguments")
+					continue
+				}
+				uses = n
+				if uses == 0 {
+					uses = -1
+				}
+			}
+			if len(parts) > 2 {
+				d, err := parseDuration(parts[2])
+				if err != nil || d > inviteCodeMaxTTL {
+					conn.fail("", "INVITECODE", "invalid_arguments")
+					continue
+				}
+				ttl = d
+			}
+			groupID, err := srv.message.GetGroupChatID(parts[0])
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR KICK group_not_found %s\n", err)))
+				conn.fail(err.Error(), "INVITECODE", "group_not_found")
 				continue
 			}
-			isOwner, _ := srv.message.IsGroupOwner(int(currentUser.ID), groupID)
-			if !isOwner {
-				conn.Write([]byte("ERR KICK not_authorized\n"))
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionInvite) {
+				conn.fail("", "INVITECODE", "not_authorized")
 				continue
 			}
-			target, err := srv.user.GetUserByUsername(targetUser)
+			code, err := srv.redis.CreateInviteCode(groupID, currentUser.Name, uses, ttl)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR KICK user_not_found %s\n", err)))
+				conn.fail(err.Error(), "INVITECODE")
 				continue
 			}
-			if err := srv.message.RemoveGroupMember(int(target.ID), groupID); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR KICK %s\n", err)))
-			} else {
-				conn.Write([]byte(fmt.Sprintf("OK KICK %s %s\n", groupName, targetUser)))
-				// Notify the user they were kicked
-				_ = srv.redis.Client.Publish(context.Background(), notifyChannel(targetUser), fmt.Sprintf("KICK %s", groupName)).Err()
-			}
+			conn.ok("INVITECODE", parts[0], code, strconv.Itoa(uses), time.Now().Add(ttl).Format(time.RFC3339))
+
+		case "/invitecodes":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			groupID, err := srv.message.GetGroupChatID(strings.TrimSpace(argLine))
+			if err != nil {
+				conn.fail(err.Error(), "INVITECODES", "group_not_found")
+				continue
+			}
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionInviteCodes) {
+				conn.fail("", "INVITECODES", "not_authorized")
+				continue
+			}
+			codes, err := srv.redis.ListInviteCodes(groupID)
+			if err != nil {
+				conn.fail(err.Error(), "INVITECODES")
+				continue
+			}
+			if len(codes) == 0 {
+				conn.send(protocol.NewFrame("INVITECODE", "NONE"))
+				continue
+			}
+			for _, c := range codes {
+				conn.send(protocol.NewFrame("INVITECODE", c.Code).With(strconv.Itoa(c.UsesLeft), c.ExpiresAt, c.CreatedBy))
+			}
+
+		case "/revokecode":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", "REVOKECODE", "invalid_arguments")
+				continue
+			}
+			groupID, err := srv.message.GetGroupChatID(parts[0])
+			if err != nil {
+				conn.fail(err.Error(), "REVOKECODE", "group_not_found")
+				continue
+			}
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionInviteCodes) {
+				conn.fail("", "REVOKECODE", "not_authorized")
+				continue
+			}
+			if ok, err := srv.redis.RevokeInviteCode(groupID, parts[1]); err != nil || !ok {
+				conn.fail("", "REVOKECODE", "code_not_found")
+				continue
+			}
+			conn.ok("REVOKECODE", parts[1])
+
+		case "/redeem":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			code := strings.TrimSpace(argLine)
+			groupID, err := srv.redis.InviteCodeGroup(code)
+			if err != nil || groupID == 0 {
+				conn.fail("", "REDEEM", "invalid_code")
+				continue
+			}
+			group, err := srv.message.GetGroupChat(groupID)
+			if err != nil {
+				conn.fail(err.Error(), "REDEEM")
+				continue
+			}
+			// Members keep the code's uses for someone else
+			if srv.groupRole(int(currentUser.ID), groupID) == "" {
+				if id, err := srv.redis.RedeemInviteCode(code); err != nil || id != groupID {
+					conn.fail("", "REDEEM", "invalid_code")
+					continue
+				}
+				if err := srv.message.JoinGroupChat(int(currentUser.ID), groupID); err != nil {
+					conn.fail(err.Error(), "REDEEM")
+					continue
+				}
+			}
+			conn.ok("JOIN", group.Name)
+
+		// =====================================================
+		// JOIN REQUESTS — answered by the owner and admins
+		//
+		//   → /requests <group>
+		//   ← JOINREQ <group> <user>   (or JOINREQ NONE)
+		//   → /approve <group> <user>
+		//   ← OK APPROVE <group> <user>
+		//   → /deny <group> <user>
+		//   ← OK DENY <group> <user>
+		// =====================================================
+		case "/requests":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			name := strings.TrimSpace(argLine)
+			id, err := srv.message.GetGroupChatID(name)
+			if err != nil {
+				conn.fail(err.Error(), "REQUESTS", "group_not_found")
+				continue
+			}
+			if !srv.groupCan(currentUser, id, msgpkg.ActionApprove) {
+				conn.fail("", "REQUESTS", "not_authorized")
+				continue
+			}
+			pending, err := srv.message.GetJoinRequests(id)
+			if err != nil {
+				conn.fail(err.Error(), "REQUESTS")
+				continue
+			}
+			if len(pending) == 0 {
+				conn.send(protocol.NewFrame("JOINREQ", "NONE"))
+				continue
+			}
+			for _, u := range pending {
+				conn.send(protocol.NewFrame("JOINREQ", name, u))
+			}
+
+		case "/approve", "/deny":
+			verb := strings.ToUpper(strings.TrimPrefix(cmd, "/"))
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", verb, "invalid_arguments")
+				continue
+			}
+			groupName, targetUser := parts[0], parts[1]
+			groupID, err := srv.message.GetGroupChatID(groupName)
+			if err != nil {
+				conn.fail(err.Error(), verb, "group_not_found")
+				continue
+			}
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionApprove) {
+				conn.fail("", verb, "not_authorized")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(targetUser)
+			if err != nil {
+				conn.fail(err.Error(), verb, "user_not_found")
+				continue
+			}
+			ok, err := srv.message.TakeJoinRequest(groupID, int(target.ID))
+			if err != nil || !ok {
+				conn.fail("", verb, "no_request")
+				continue
+			}
+			if cmd == "/approve" {
+				if err := srv.message.JoinGroupChat(int(target.ID), groupID); err != nil {
+					conn.fail(err.Error(), verb)
+					continue
+				}
+			}
+			conn.ok(verb, groupName, target.Name)
+			notice := map[string]string{"/approve": "APPROVED", "/deny": "DENIED"}[cmd]
+			srv.publishNotify(target.Name, protocol.NewFrame("NOTIFY", notice).With(groupName))
+
+		// =====================================================
+		// VISIBILITY — public, private or invite_only (owner, admin)
+		//
+		//   → /visibility <group> <public|private|invite_only>
+		//   ← OK VISIBILITY <group> <visibility>
+		// =====================================================
+		case "/visibility":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 || !msgpkg.ValidVisibility(parts[1]) {
+				conn.fail("", "VISIBILITY", "invalid_arguments")
+				continue
+			}
+			groupID, err := srv.message.GetGroupChatID(parts[0])
+			if err != nil {
+				conn.fail(err.Error(), "VISIBILITY", "group_not_found")
+				continue
+			}
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionSettings) {
+				conn.fail("", "VISIBILITY", "not_authorized")
+				continue
+			}
+			if err := srv.message.SetGroupVisibility(groupID, parts[1]); err != nil {
+				conn.fail(err.Error(), "VISIBILITY")
+				continue
+			}
+			conn.ok("VISIBILITY", parts[0], parts[1])
+
+		// =====================================================
+		// LEAVE GROUP
+		// =====================================================
+		case "/leave":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			name := strings.TrimSpace(argLine)
+			id, err := srv.message.GetGroupChatID(name)
+			if err != nil {
+				conn.fail(err.Error(), "LEAVE")
+				continue
+			}
+			heir, err := srv.message.LeaveGroupChat(int(currentUser.ID), id)
+			if err != nil {
+				conn.fail(err.Error(), "LEAVE")
+				continue
+			}
+			conn.ok("LEAVE", name)
+			if heir != "" {
+				srv.groupNotice(id, fmt.Sprintf("%s left, %s is the new owner", currentUser.Name, heir))
+				srv.publishNotify(heir, protocol.NewFrame("NOTIFY", "ROLE").With(name, msgpkg.RoleOwner))
+			}
+
+		// =====================================================
+		// TRANSFER — hand the group to another member (owner only)
+		//
+		//   → /transfer <group> <user>
+		//   ← OK TRANSFER <group> <user>
+		// =====================================================
+		case "/transfer":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", "TRANSFER", "invalid_arguments")
+				continue
+			}
+			groupName, targetUser := parts[0], parts[1]
+			groupID, err := srv.message.GetGroupChatID(groupName)
+			if err != nil {
+				conn.fail(err.Error(), "TRANSFER", "group_not_found")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(targetUser)
+			if err != nil {
+				conn.fail(err.Error(), "TRANSFER", "user_not_found")
+				continue
+			}
+			if srv.groupRole(int(currentUser.ID), groupID) != msgpkg.RoleOwner {
+				conn.fail("", "TRANSFER", "not_authorized")
+				continue
+			}
+			if target.ID == currentUser.ID {
+				conn.fail("", "TRANSFER", "invalid_arguments")
+				continue
+			}
+			if err := srv.message.TransferGroupOwnership(groupID, int(currentUser.ID), int(target.ID)); err != nil {
+				conn.fail(err.Error(), "TRANSFER")
+				continue
+			}
+			conn.ok("TRANSFER", groupName, target.Name)
+			srv.groupNotice(groupID, fmt.Sprintf("%s handed ownership to %s", currentUser.Name, target.Name))
+			srv.publishNotify(target.Name, protocol.NewFrame("NOTIFY", "ROLE").With(groupName, msgpkg.RoleOwner))
 
 		// =====================================================
-		// INVITE TO GROUP (Owner only)
-		// =====================================================
+		// KICK FROM GROUP (owner, admin, moderator; lower roles only)
+		// =====================================================
+		case "/kick":
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) != 2 {
+				conn.fail("", "KICK", "invalid_arguments")
+				continue
+			}
+			groupName, targetUser := parts[0], parts[1]
+			groupID, err := srv.message.GetGroupChatID(groupName)
+			if err != nil {
+				conn.fail(err.Error(), "KICK", "group_not_found")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(targetUser)
+			if err != nil {
+				conn.fail(err.Error(), "KICK", "user_not_found")
+				continue
+			}
+			targetRole := srv.groupRole(int(target.ID), groupID)
+			if targetRole == "" {
+				conn.fail("", "KICK", "not_a_member")
+				continue
+			}
+			if !msgpkg.CanManage(srv.groupRole(int(currentUser.ID), groupID), targetRole, msgpkg.ActionKick, "") {
+				conn.fail("", "KICK", "not_authorized")
+				continue
+			}
+			if err := srv.message.RemoveGroupMember(int(target.ID), groupID); err != nil {
+				conn.fail(err.Error(), "KICK")
+			} else {
+				conn.ok("KICK", groupName, targetUser)
+				// Close the room for them and notify the user they were kicked
+				srv.removeFromGroup(groupID, target.Name)
+				srv.publishNotify(targetUser, protocol.NewFrame("NOTIFY", "KICK").With(groupName))
+			}
+
+		// =====================================================
+		// INVITE TO GROUP (owner, admin, moderator)
+		// =====================================================
 		case "/invite":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			parts := strings.Fields(argLine)
 			if len(parts) != 2 {
-				conn.Write([]byte("ERR INVITE invalid_arguments\n"))
+				conn.fail("", "INVITE", "invalid_arguments")
 				continue
 			}
 			groupName, targetUser := parts[0], parts[1]
 			groupID, err := srv.message.GetGroupChatID(groupName)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR INVITE group_not_found %s\n", err)))
+				conn.fail(err.Error(), "INVITE", "group_not_found")
 				continue
 			}
-			isOwner, _ := srv.message.IsGroupOwner(int(currentUser.ID), groupID)
-			if !isOwner {
-				conn.Write([]byte("ERR INVITE not_authorized\n"))
+			if !srv.groupCan(currentUser, groupID, msgpkg.ActionInvite) {
+				conn.fail("", "INVITE", "not_authorized")
 				continue
 			}
 			target, err := srv.user.GetUserByUsername(targetUser)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR INVITE user_not_found %s\n", err)))
+				conn.fail(err.Error(), "INVITE", "user_not_found")
 				continue
 			}
-			if err := srv.message.AddGroupMember(int(target.ID), groupID); err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR INVITE %s\n", err)))
+			group, err := srv.message.GetGroupChat(groupID)
+			if err != nil {
+				conn.fail(err.Error(), "INVITE")
+				continue
+			}
+			// Public groups take the user in at once, others keep an invite
+			// for their /join
+			if group.Visibility == msgpkg.VisibilityPublic {
+				err = srv.message.AddGroupMember(int(target.ID), groupID)
 			} else {
-				conn.Write([]byte(fmt.Sprintf("OK INVITE %s %s\n", groupName, targetUser)))
+				err = srv.message.AddGroupInvite(groupID, int(target.ID), int(currentUser.ID))
+			}
+			if err != nil {
+				conn.fail(err.Error(), "INVITE")
+			} else {
+				conn.ok("INVITE", groupName, targetUser)
 				// Notify the user they were invited
-				_ = srv.redis.Client.Publish(context.Background(), notifyChannel(targetUser), fmt.Sprintf("INVITE %s", groupName)).Err()
+				srv.publishNotify(targetUser, protocol.NewFrame("NOTIFY", "INVITE").With(groupName))
+			}
+
+		// =====================================================
+		// GROUP ROLES — owner > admin > moderator > member
+		//
+		//   → /promote <group> <user> <admin|moderator>
+		//   ← OK PROMOTE <group> <user> <role>
+		//   → /demote <group> <user> [moderator|member]
+		//   ← OK DEMOTE <group> <user> <role>
+		// =====================================================
+		case "/promote", "/demote":
+			verb := strings.ToUpper(strings.TrimPrefix(cmd, "/"))
+			if currentUser == nil {
+				conn.fail("", "AUTH", "not_logged_in")
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) == 2 && cmd == "/demote" {
+				parts = append(parts, msgpkg.RoleMember)
+			}
+			if len(parts) != 3 || !msgpkg.ValidRole(parts[2]) {
+				conn.fail("", verb, "invalid_arguments")
+				continue
+			}
+			groupName, targetUser, role := parts[0], parts[1], parts[2]
+			groupID, err := srv.message.GetGroupChatID(groupName)
+			if err != nil {
+				conn.fail(err.Error(), verb, "group_not_found")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(targetUser)
+			if err != nil {
+				conn.fail(err.Error(), verb, "user_not_found")
+				continue
+			}
+			targetRole := srv.groupRole(int(target.ID), groupID)
+			if targetRole == "" {
+				conn.fail("", verb, "not_a_member")
+				continue
+			}
+			// /promote only goes up and /demote only down
+			up := msgpkg.RoleRank(role) > msgpkg.RoleRank(targetRole)
+			if up != (cmd == "/promote") || role == targetRole {
+				conn.fail("", verb, "invalid_role")
+				continue
+			}
+			if !msgpkg.CanManage(srv.groupRole(int(currentUser.ID), groupID), targetRole, msgpkg.ActionPromote, role) {
+				conn.fail("", verb, "not_authorized")
+				continue
+			}
+			if err := srv.message.SetGroupRole(int(target.ID), groupID, role); err != nil {
+				conn.fail(err.Error(), verb)
+				continue
 			}
+			conn.ok(verb, groupName, target.Name, role)
+			srv.publishNotify(target.Name, protocol.NewFrame("NOTIFY", "ROLE").With(groupName, role))
+
+		// =====================================================
+		// SERVER ADMIN — moderation across the whole server
+		//
+		//   → /ban <user> [duration] [reason]
+		//   ← OK BAN <user> <until=...|permanent>
+		//   → /unban <user>
+		//   ← OK UNBAN <user>
+		//   → /mute <user> <room|global> [duration]
+		//   ← OK MUTE <user> <room> <until=...|permanent>
+		//   → /unmute <user> <room|global>
+		//   ← OK UNMUTE <user> <room>
+		//   → /announce <text>
+		//   ← OK ANNOUNCE
+		//   → /purge <user>
+		//   ← OK PURGE <user> <count>
+		// =====================================================
+		case "/ban":
+			if !srv.requireAdmin(conn, currentUser, "BAN") {
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) == 0 {
+				conn.fail("", "BAN", "invalid_arguments")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(parts[0])
+			if err != nil {
+				conn.fail(err.Error(), "BAN", "user_not_found")
+				continue
+			}
+			if target.ID == currentUser.ID {
+				conn.fail("", "BAN", "not_authorized")
+				continue
+			}
+			// A duration is optional, anything else is the reason
+			var until *time.Time
+			reason := strings.Join(parts[1:], " ")
+			if len(parts) > 1 {
+				if d, err := parseDuration(parts[1]); err == nil {
+					t := time.Now().Add(d)
+					until = &t
+					reason = strings.Join(parts[2:], " ")
+				}
+			}
+			if err := srv.user.BanUser(int(target.ID), int(currentUser.ID), reason, until); err != nil {
+				conn.fail(err.Error(), "BAN")
+				continue
+			}
+			srv.revokeSessions(target.Email, "")
+			srv.logger.Warn("User banned", "user", target.Name, "by", currentUser.Name, "until", until, "reason", reason)
+			untilWord := "permanent"
+			if until != nil {
+				untilWord = "until=" + until.Format(time.RFC3339)
+			}
+			conn.ok("BAN", target.Name, untilWord)
+
+		case "/unban":
+			if !srv.requireAdmin(conn, currentUser, "UNBAN") {
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(strings.TrimSpace(argLine))
+			if err != nil {
+				conn.fail(err.Error(), "UNBAN", "user_not_found")
+				continue
+			}
+			if err := srv.user.UnbanUser(int(target.ID)); err != nil {
+				conn.fail(err.Error(), "UNBAN")
+				continue
+			}
+			conn.ok("UNBAN", target.Name)
+
+		case "/mute", "/unmute":
+			verb := strings.ToUpper(strings.TrimPrefix(cmd, "/"))
+			if !srv.requireAdmin(conn, currentUser, verb) {
+				continue
+			}
+			parts := strings.Fields(argLine)
+			if len(parts) < 2 || len(parts) > 3 || (cmd == "/unmute" && len(parts) != 2) {
+				conn.fail("", verb, "invalid_arguments")
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(parts[0])
+			if err != nil {
+				conn.fail(err.Error(), verb, "user_not_found")
+				continue
+			}
+			room, err := srv.moderatedRoom(parts[1])
+			if err != nil {
+				conn.fail(err.Error(), verb, "group_not_found")
+				continue
+			}
+			if cmd == "/unmute" {
+				if ok, err := srv.redis.UnmuteInRoom(room.channel, target.Name); err != nil || !ok {
+					conn.fail("", verb, "not_muted")
+					continue
+				}
+				conn.ok(verb, target.Name, parts[1])
+				continue
+			}
+			var d time.Duration
+			if len(parts) == 3 {
+				if d, err = parseDuration(parts[2]); err != nil {
+					conn.fail(err.Error(), verb, "invalid_arguments")
+					continue
+				}
+			}
+			if err := srv.redis.MuteInRoom(room.channel, target.Name, d); err != nil {
+				conn.fail(err.Error(), verb)
+				continue
+			}
+			untilWord := "permanent"
+			if d > 0 {
+				untilWord = "until=" + time.Now().Add(d).Format(time.RFC3339)
+			}
+			conn.ok(verb, target.Name, parts[1], untilWord)
+
+		case "/announce":
+			if !srv.requireAdmin(conn, currentUser, "ANNOUNCE") {
+				continue
+			}
+			text := strings.TrimSpace(argLine)
+			if text == "" {
+				conn.fail("", "ANNOUNCE", "invalid_arguments")
+				continue
+			}
+			if err := srv.announce(currentUser.Name, text); err != nil {
+				conn.fail(err.Error(), "ANNOUNCE")
+				continue
+			}
+			conn.ok("ANNOUNCE")
+
+		case "/purge":
+			if !srv.requireAdmin(conn, currentUser, "PURGE") {
+				continue
+			}
+			target, err := srv.user.GetUserByUsername(strings.TrimSpace(argLine))
+			if err != nil {
+				conn.fail(err.Error(), "PURGE", "user_not_found")
+				continue
+			}
+			count, err := srv.purgeMessages(target, currentUser)
+			if err != nil {
+				conn.fail(err.Error(), "PURGE")
+				continue
+			}
+			srv.logger.Warn("Messages purged", "user", target.Name, "by", currentUser.Name, "count", count)
+			conn.ok("PURGE", target.Name, strconv.Itoa(count))
 
 		// =====================================================
 		// GLOBAL ROOM
 		// =====================================================
 		case "/global":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			id, err := srv.message.GetGlobalChatID()
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR GLOBAL %s\n", err)))
+				conn.fail(err.Error(), "GLOBAL")
 				continue
 			}
 			handleGroupChat(conn, srv, "Global", id, currentUser, sessionID, reader)
@@ -610,13 +1625,13 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 		// =====================================================
 		case "/group":
 			if currentUser == nil {
-				conn.Write([]byte("ERR AUTH not_logged_in\n"))
+				conn.fail("", "AUTH", "not_logged_in")
 				continue
 			}
 			name := strings.TrimSpace(argLine)
 			id, err := srv.message.GetGroupChatID(name)
 			if err != nil {
-				conn.Write([]byte(fmt.Sprintf("ERR GROUP %s\n", err)))
+				conn.fail(err.Error(), "GROUP")
 				continue
 			}
 			handleGroupChat(conn, srv, name, id, currentUser, sessionID, reader)
@@ -638,11 +1653,21 @@ func handleTelnetClient(conn net.Conn, srv *Server) {
 			// Wait, the main loop is for generic commands.
 			// Let's add /react to the specific chat loops.
 		default:
-			conn.Write([]byte("ERR UNKNOWN_COMMAND\n"))
+			conn.fail("", "UNKNOWN_COMMAND")
 		}
 	}
 }
 
+// partnerFrame builds "OK <verb> <partner>" with the partner's presence and
+// last seen time as fields.
+func partnerFrame(srv *Server, verb, partner string) protocol.Frame {
+	lastSeen := ""
+	if u, err := srv.user.GetUserByUsername(partner); err == nil {
+		lastSeen = u.LastLogin
+	}
+	return protocol.NewFrame("OK", verb, partner).With(srv.presenceOf(partner)[partner], lastSeen)
+}
+
 func makeTempChatChannel(u1, u2 string) string {
 	a := strings.ToLower(strings.TrimSpace(u1))
 	b := strings.ToLower(strings.TrimSpace(u2))
@@ -671,26 +1696,53 @@ func formatReactions(reactions map[string]string) string {
 	return "{" + strings.Join(res, " ") + "}"
 }
 
-func handleGroupChat(conn net.Conn, srv *Server, groupName string, groupID int, currentUser *factory.User, sessionID string, reader *bufio.Reader) {
-	conn.Write([]byte(fmt.Sprintf("OK GROUP %s %d\n", groupName, groupID)))
+// histFrame renders a stored message as a HIST frame.
+//
+// Fields: <id>|<timestamp>|<sender>|<content>|<reactions>|<flags>|<parent_id>|<read_by>
+func histFrame(m factory.Message) protocol.Frame {
+	return protocol.NewFrame("HIST").With(strconv.Itoa(m.ID), m.SentAt, m.SenderName, m.Content, formatReactions(m.Reactions), messageFlags(m), parentRef(m.ParentID), strings.Join(m.ReadBy, ","))
+}
 
-	// Fetch history
-	messages, err := srv.message.GetGroupChatMessages(groupID)
+// messageFlags returns the comma separated state markers of a message,
+// e.g. "edited" or "edited,deleted".
+func messageFlags(m factory.Message) string {
+	var flags []string
+	if m.EditedAt != "" {
+		flags = append(flags, "edited")
+	}
+	if m.DeletedAt != "" {
+		flags = append(flags, "deleted")
+	}
+	return strings.Join(flags, ",")
+}
+
+func handleGroupChat(conn *clientConn, srv *Server, groupName string, groupID int, currentUser *factory.User, sessionID string, reader *bufio.Reader) {
+	if err := srv.authorizeGroup(currentUser, groupID); err != nil {
+		conn.fail("", "GROUP", "not_a_member")
+		return
+	}
+	conn.ok("GROUP", groupName, fmt.Sprint(groupID))
+
+	// Fetch history, latest page only; older pages come via /more
+	messages, err := srv.message.GetGroupChatMessages(groupID, 0, historyPageSize)
 	if err != nil {
-		conn.Write([]byte(fmt.Sprintf("ERR GROUP history_failed %s\n", err)))
+		conn.fail(err.Error(), "GROUP", "history_failed")
 		return
 	}
 	for _, m := range messages {
-		reactionsStr := formatReactions(m.Reactions)
-		conn.Write([]byte(fmt.Sprintf("HIST %s|%s|%s|%s\n", m.SentAt, m.SenderName, m.Content, reactionsStr)))
+		conn.send(histFrame(m))
 	}
-	conn.Write([]byte("OK GROUP READY\n"))
+	conn.ok("GROUP", "READY")
+	srv.sendGroupInfo(conn, groupID)
 
-	channelName := fmt.Sprintf("group:%d", groupID)
+	room := groupRoom(groupID)
+	if len(messages) > 0 {
+		srv.markRead(currentUser, room, messages[len(messages)-1].ID, sessionID)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	pubsub := srv.redis.Client.Subscribe(ctx, channelName)
+	pubsub := srv.redis.Client.Subscribe(ctx, room.channel)
 	defer pubsub.Close()
 	msgChan := pubsub.Channel()
 
@@ -698,6 +1750,13 @@ func handleGroupChat(conn net.Conn, srv *Server, groupName string, groupID int,
 	var once sync.Once
 	safeClose := func() { once.Do(func() { close(done) }) }
 
+	// Set when the user is kicked while in the room. The read below is cut
+	// short with a deadline so the room closes without waiting for input.
+	// Both happen inside once, before done closes, and every exit path
+	// goes through once too, so GroupExit always sees the deadline that it
+	// has to clear.
+	var removed atomic.Bool
+
 	mySessionID := sessionID
 
 	// Forward messages
@@ -710,16 +1769,18 @@ func handleGroupChat(conn net.Conn, srv *Server, groupName string, groupID int,
 				if !ok {
 					return
 				}
-				// Format: <sender>|<ts>|<content>
-				// Wait, I didn't include sessionID in the Redis payload for groups in SendGroupMessage
-				// Let's go back and fix that first to avoid echo.
-				segs := strings.SplitN(msg.Payload, "|", 4)
-				if len(segs) == 4 {
-					fromSess, sender, ts, content := segs[0], segs[1], segs[2], segs[3]
-					if fromSess == mySessionID {
-						continue
-					}
-					conn.Write([]byte(fmt.Sprintf("MSG %s|%s|%s\n", sender, ts, content)))
+				ev, ok := forwardChatEvent(conn, msg.Payload, mySessionID)
+				if ok && ev.Type == "MSG" && ev.Sender != currentUser.Name {
+					srv.markRead(currentUser, room, ev.MessageID, mySessionID)
+				}
+				if ok && ev.Type == "REMOVE" && strings.EqualFold(ev.Sender, currentUser.Name) {
+					once.Do(func() {
+						removed.Store(true)
+						conn.SetReadDeadline(time.Now())
+						conn.fail("", "GROUP", "removed")
+						close(done)
+					})
+					return
 				}
 			}
 		}
@@ -734,6 +1795,7 @@ func handleGroupChat(conn net.Conn, srv *Server, groupName string, groupID int,
 
 		msgLine, err := reader.ReadString('\n')
 		if err != nil {
+			// Waits for a REMOVE in progress, see removed above
 			safeClose()
 			break
 		}
@@ -741,29 +1803,39 @@ func handleGroupChat(conn net.Conn, srv *Server, groupName string, groupID int,
 		if msgLine == "" {
 			continue
 		}
-		senderName := currentUser.Name
 		if msgLine == "/exit" {
 			safeClose()
 			break
 		}
+		if !srv.allowLine(conn, currentUser.Name, mySessionID) {
+			continue
+		}
+		// Every command and message in the room is checked, so a kick that
+		// raced the REMOVE event is still caught
+		if err := srv.authorizeGroup(currentUser, groupID); err != nil {
+			conn.fail("", "GROUP", "not_a_member")
+			safeClose()
+			break
+		}
 
-		if strings.HasPrefix(msgLine, "/react ") {
-			emoji := strings.TrimPrefix(msgLine, "/react ")
-			id, err := srv.message.GetLastMessageID("group", groupID)
-			if err == nil {
-				srv.message.AddReaction(id, int(currentUser.ID), emoji)
-				payload := fmt.Sprintf("%s|%s|REACTION|%s", mySessionID, senderName, emoji)
-				_ = srv.redis.Client.Publish(ctx, channelName, payload).Err()
-			}
+		if handleChatCommand(conn, srv, currentUser, room, mySessionID, msgLine) {
 			continue
 		}
 
-		if err := srv.message.SendGroupMessage(int(currentUser.ID), groupID, msgLine, mySessionID); err != nil {
-			conn.Write([]byte(fmt.Sprintf("ERR GROUP send_failed %s\n", err)))
+		if !srv.allowSend(conn, currentUser.Name, room.channel) {
 			continue
 		}
+		id, err := srv.message.SendGroupMessage(int(currentUser.ID), groupID, msgLine, 0, mySessionID)
+		if err != nil {
+			conn.fail(err.Error(), "GROUP", "send_failed")
+			continue
+		}
+		conn.ok("SENT", strconv.Itoa(id))
 	}
 
 GroupExit:
-	conn.Write([]byte("OK GROUP EXIT\n"))
+	if removed.Load() {
+		conn.SetReadDeadline(time.Time{})
+	}
+	conn.ok("GROUP", "EXIT")
 }
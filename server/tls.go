@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// tcpListener opens the chat listener. TLS is used whenever tls_cert and
+// tls_key are configured; plain TCP only when allow_plaintext is set,
+// which is meant for local development.
+func tcpListener(port string) (net.Listener, error) {
+	cfg, err := serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		return tls.Listen("tcp", ":"+port, cfg)
+	}
+	if !viper.GetBool("allow_plaintext") {
+		return nil, fmt.Errorf("tls_cert and tls_key are not configured (set allow_plaintext for local dev)")
+	}
+	return net.Listen("tcp", ":"+port)
+}
+
+// serverTLSConfig builds the listener's TLS config from tls_cert/tls_key.
+// With tls_client_ca set, clients must also present a certificate signed
+// by that CA, unless tls_client_auth is "optional".
+func serverTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := viper.GetString("tls_cert"), viper.GetString("tls_key")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile := viper.GetString("tls_client_ca"); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if viper.GetString("tls_client_auth") == "optional" {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
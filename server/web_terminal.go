@@ -3,10 +3,11 @@ package server
 import (
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
-	"os"
-	"os/exec"
+	"termchat/client"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
 )
@@ -17,6 +18,10 @@ type resizeMsg struct {
 	Rows uint16 `json:"rows"`
 }
 
+// HandleWebClient runs the TUI in-process on a PTY and bridges it to a
+// browser terminal over a websocket. Like SSH sessions it talks to the
+// backend through dialLocal, so it keeps working when the chat port only
+// speaks TLS.
 func (s *Server) HandleWebClient() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -27,29 +32,55 @@ func (s *Server) HandleWebClient() http.HandlerFunc {
 		}
 		defer conn.Close()
 
-		exePath, err := os.Executable()
+		ptmx, tty, err := pty.Open()
 		if err != nil {
-			s.logger.Error("Failed to get executable path", "error", err)
-			return
-		}
-
-		cmd := exec.Command(exePath, "-mode=client")
-
-		ptmx, err := pty.Start(cmd)
-		if err != nil {
-			s.logger.Error("PTY start failed", "error", err)
+			s.logger.Error("PTY open failed", "error", err)
 			return
 		}
 		defer func() {
+			tty.Close()
 			ptmx.Close()
-			cmd.Process.Kill()
 		}()
 
+		useHostedColorProfile()
 		pty.Setsize(ptmx, &pty.Winsize{
 			Rows: 40,
 			Cols: 120,
 		})
 
+		// Remember the backend connection so it can be closed with the TUI
+		var remote net.Addr
+		if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			remote = addr
+		}
+		backend := make(chan net.Conn, 1)
+		dial := func() (net.Conn, error) {
+			conn, err := s.dialLocal(remote)
+			if err == nil {
+				backend <- conn
+			}
+			return conn, err
+		}
+		program := tea.NewProgram(
+			client.NewSessionModel(dial, "", tty),
+			tea.WithInput(tty),
+			tea.WithOutput(tty),
+			tea.WithAltScreen(),
+			tea.WithMouseCellMotion(),
+		)
+		go func() {
+			if _, err := program.Run(); err != nil {
+				s.logger.Error("Web TUI failed", "error", err)
+			}
+			select {
+			case c := <-backend:
+				c.Close()
+			default:
+			}
+			conn.Close()
+		}()
+		defer program.Quit()
+
 		// Terminal → Browser
 		go func() {
 			buf := make([]byte, 4096)
@@ -57,7 +88,7 @@ func (s *Server) HandleWebClient() http.HandlerFunc {
 				n, err := ptmx.Read(buf)
 				if err != nil {
 					if err != io.EOF {
-						s.logger.Error("PTY read error", "error", err)
+						s.logger.Debug("PTY read error", "error", err)
 					}
 					return
 				}
@@ -79,6 +110,7 @@ func (s *Server) HandleWebClient() http.HandlerFunc {
 						Rows: rmsg.Rows,
 						Cols: rmsg.Cols,
 					})
+					program.Send(tea.WindowSizeMsg{Width: int(rmsg.Cols), Height: int(rmsg.Rows)})
 					continue
 				}
 			}
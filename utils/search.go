@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// minTokenLen drops one letter words, which match almost every message
+const minTokenLen = 2
+
+// SearchTokens splits text into lower-cased words for the search index,
+// each at most once.
+func SearchTokens(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < minTokenLen || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// BlindTokens turns search tokens into keyed HMAC-SHA256 digests, so the
+// index can be matched exactly without storing any readable words. The
+// HMAC key is derived from the encryption key rather than reusing it.
+func BlindTokens(tokens []string, key []byte) []string {
+	derived := hmac.New(sha256.New, key)
+	derived.Write([]byte("termchat search index v1"))
+	indexKey := derived.Sum(nil)
+
+	blinded := make([]string, len(tokens))
+	for i, token := range tokens {
+		mac := hmac.New(sha256.New, indexKey)
+		mac.Write([]byte(token))
+		blinded[i] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return blinded
+}